@@ -10,60 +10,389 @@ Unless required by applicable law or agreed to in writing, software distributed
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/mitchellh/colorstring"
 	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/metrics"
 	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+	"github.com/pivotal-cf/spinnaker-resource/tracing"
 )
 
 func main() {
 	var request concourse.CheckRequest
 	concourse.ReadRequest(&request)
 
-	spinClient, err := spinnaker.NewClient(request.Source)
+	transport, err := spinnaker.NewTransport(request.Source)
 	if err != nil {
-		concourse.Fatal("check step failed", err)
+		fail(request, err)
 	}
+	metrics.Setup(request.Source, "check", transport)
+	tracing.Setup(request.Source, "check", transport)
 
-	Data, err := spinClient.GetPipelineExecutions()
+	ctx, cancel := concourse.SignalContext()
+	defer cancel()
+
+	spinClient, err := spinnaker.NewReadClient(ctx, request.Source)
+	if err != nil {
+		fail(request, err)
+	}
+	//put tags its triggers for the source as configured
+	configured := request.Source
+	request.Source = spinClient.Source()
+
+	applications, err := resolveApplications(ctx, spinClient, request.Source)
+	if err != nil {
+		fail(request, err)
+	}
+
+	orderKey, err := executionOrder(request.Source.OrderBy, request.Source.EmitStatusTransitions)
+	if err != nil {
+		fail(request, err)
+	}
+
+	previous, err := previousExecution(ctx, spinClient, request.Version.Ref)
+	if err != nil {
+		fail(request, err)
+	}
+
+	query, err := executionsQuery(request.Source, previous, time.Now())
+	if err != nil {
+		fail(request, err)
+	}
+
+	//executions started before the previous version may have ended or changed status since
+	lookback := request.Source.OrderBy == "end_time" || request.Source.EmitStatusTransitions
+	Data, err := fetchExecutions(ctx, spinClient, applications, previous, query, lookback)
 	if err != nil {
-		concourse.Fatal("check step failed", err)
+		fail(request, err)
 	}
 
-	pipelineExecutions := filterName(request.Source.SpinnakerPipeline, Data)
+	pipelineRegex, err := request.Source.PipelineRegex()
+	if err != nil {
+		fail(request, err)
+	}
+	pipelineExecutions := filterName(request.Source.Pipelines(), pipelineRegex, Data)
+
+	pipelineExecutions = filterTriggeredSince(query.TriggerTimeStartBoundary, pipelineExecutions)
+
+	nameRegex, err := request.Source.ExecutionNameRegex()
+	if err != nil {
+		fail(request, err)
+	}
+	pipelineExecutions = filterExecutionName(nameRegex, pipelineExecutions)
 
 	pipelineExecutions = filterStatus(request.Source.Statuses, pipelineExecutions)
 
+	if request.Source.IgnoreCanceled {
+		pipelineExecutions = filterCanceled(pipelineExecutions)
+	}
+
+	pipelineExecutions = filterTriggerType(request.Source.TriggerTypes, pipelineExecutions)
+
+	pipelineExecutions = filterTriggerUser(request.Source.TriggeredBy, request.Source.IgnoreTriggeredBy, pipelineExecutions)
+
+	pipelineExecutions = filterParameters(request.Source.MatchParameters, pipelineExecutions)
+
+	pipelineExecutions = filterRequiredStage(request.Source.RequireStage, pipelineExecutions)
+
+	artifactName, artifactVersion, err := request.Source.MatchArtifact.Regexes()
+	if err != nil {
+		fail(request, err)
+	}
+	pipelineExecutions = filterArtifact(request.Source.MatchArtifact.Type, artifactName, artifactVersion, pipelineExecutions)
+
+	if request.Source.TriggeredByMeOnly {
+		pipelineExecutions = filterTriggeredBy(configured, pipelineExecutions)
+	}
+
+	//executions are only ordered by end_time once they ended, as one ending
+	//later than a version emitted meanwhile would be ordered before it
+	if request.Source.OrderBy == "end_time" && !request.Source.EmitStatusTransitions {
+		pipelineExecutions = filterEnded(pipelineExecutions)
+	}
+
 	if len(pipelineExecutions) == 0 {
 		concourse.WriteResponse(concourse.CheckResponse{})
 	}
 
-	//Sort Data by build time Asc
-	sort.Slice(pipelineExecutions, func(i, j int) bool {
-		return pipelineExecutions[i].BuildTime < pipelineExecutions[j].BuildTime
+	pipelineExecutions = sortExecutions(pipelineExecutions, orderKey)
+
+	res := concourse.CheckResponse{}
+	var responseExecutions []spinnaker.PipelineExecution
+	if request.Source.EmitStatusTransitions {
+		responseExecutions = transitionsSince(pipelineExecutions, request.Version, previous, orderKey)
+	} else {
+		responseExecutions = newExecutions(pipelineExecutions, request.Version.Ref, previous, orderKey)
+	}
+	for _, execution := range responseExecutions {
+		version := spinnaker.VersionFor(execution, request.Source)
+		//the previous version keeps the status it was emitted with, so that its
+		//execution only becomes a new version with emit_status_transitions
+		if execution.ID == request.Version.Ref && request.Version.Status != "" && !request.Source.EmitStatusTransitions {
+			version.Status = request.Version.Status
+		}
+		res = append(res, version)
+	}
+	concourse.WriteResponse(res)
+}
+
+// fail ends the check step. With check_soft_fail, when Gate is only briefly
+// unavailable, the previous version is returned again with a warning instead.
+func fail(request concourse.CheckRequest, err error) {
+	if request.Source.CheckSoftFail && spinnaker.IsTemporary(err) {
+		concourse.Sayf(colorstring.Color("[yellow]WARNING: %s\n"), "check step failed: "+err.Error())
+		res := concourse.CheckResponse{}
+		if request.Version.Ref != "" {
+			res = append(res, request.Version)
+		}
+		concourse.WriteResponse(res)
+	}
+	concourse.Fatal("check step failed", err)
+}
+
+// resolveApplications lists the configured applications along with every
+// application in Spinnaker matching spinnaker_application_regex
+func resolveApplications(ctx context.Context, spinClient spinnaker.SpinClient, source concourse.Source) ([]string, error) {
+	applications := source.Applications()
+	regex, err := source.ApplicationRegex()
+	if err != nil || regex == nil {
+		return applications, err
+	}
+
+	names, err := spinClient.GetApplications(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if regex.MatchString(name) && !contains(applications, name) {
+			applications = append(applications, name)
+		}
+	}
+	return applications, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, currValue := range values {
+		if currValue == value {
+			return true
+		}
+	}
+	return false
+}
+
+// executionOrder returns the key versions are ordered by, the time executions
+// were started unless order_by is end_time. When emitting status transitions
+// they are ordered by the time of their latest transition instead.
+func executionOrder(orderBy string, transitions bool) (func(spinnaker.PipelineExecution) uint64, error) {
+	if transitions {
+		return transitionTime, nil
+	}
+	switch orderBy {
+	case "", "start_time":
+		return func(pe spinnaker.PipelineExecution) uint64 {
+			return pe.BuildTime
+		}, nil
+	case "end_time":
+		return func(pe spinnaker.PipelineExecution) uint64 {
+			return pe.EndTime
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid order_by: %s, must be start_time or end_time", orderBy)
+}
+
+// previousExecution looks up the previously emitted version. It returns nil
+// when there is no such version or it no longer exists, and for the version
+// of a dry_run put, which has no execution.
+func previousExecution(ctx context.Context, spinClient spinnaker.SpinClient, ref string) (*spinnaker.PipelineExecution, error) {
+	if ref == "" || ref == concourse.DryRunRef {
+		return nil, nil
+	}
+	raw, err := spinClient.GetPipelineExecutionRaw(ctx, ref)
+	if errors.Is(err, spinnaker.ErrPipelineExecutionNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var previous spinnaker.PipelineExecution
+	if err := json.Unmarshal(raw, &previous); err != nil {
+		return nil, err
+	}
+	return &previous, nil
+}
+
+// executionsQuery has Gate filter the executions by status, by pipeline name
+// when a single pipeline is watched, and by initial_max_age on the first check
+func executionsQuery(source concourse.Source, previous *spinnaker.PipelineExecution, now time.Time) (spinnaker.ExecutionsQuery, error) {
+	query := spinnaker.ExecutionsQuery{Statuses: source.Statuses}
+	if pipelines := source.Pipelines(); len(pipelines) == 1 && source.SpinnakerPipelineRegex == "" {
+		query.PipelineName = pipelines[0]
+	}
+
+	if previous == nil && source.InitialMaxAge != "" {
+		age, err := time.ParseDuration(source.InitialMaxAge)
+		if err != nil {
+			return query, fmt.Errorf("invalid initial_max_age: %s", err)
+		}
+		//buildTime is in milliseconds since the epoch
+		query.TriggerTimeStartBoundary = uint64(now.Add(-age).UnixNano() / int64(time.Millisecond))
+	}
+	return query, nil
+}
+
+// transitionTime is when the execution last changed status, as far as
+// the resource can tell: when it ended, or else when it started
+func transitionTime(pe spinnaker.PipelineExecution) uint64 {
+	if pe.EndTime != 0 {
+		return pe.EndTime
+	}
+	if pe.StartTime != 0 {
+		return pe.StartTime
+	}
+	return pe.BuildTime
+}
+
+// fetchExecutions walks back to the previously emitted version, using its
+// buildTime as the cursor, so no executions are missed however many ran since.
+// Without a version that still exists the most recent executions are used.
+// With lookback the most recent executions are always fetched too, for those
+// started before the previous version that are ordered after it.
+func fetchExecutions(ctx context.Context, spinClient spinnaker.SpinClient, applications []string, previous *spinnaker.PipelineExecution, query spinnaker.ExecutionsQuery, lookback bool) ([]spinnaker.PipelineExecution, error) {
+	var pipelineExecutions []spinnaker.PipelineExecution
+	for _, application := range applications {
+		appClient := spinClient.ForApplication(application)
+
+		var executions []spinnaker.PipelineExecution
+		if previous != nil {
+			since, err := appClient.GetPipelineExecutionsSince(ctx, previous.BuildTime, query)
+			if err != nil {
+				return nil, err
+			}
+			executions = append(executions, since...)
+		}
+		if previous == nil || lookback {
+			recent, err := appClient.GetPipelineExecutions(ctx, query)
+			if err != nil {
+				return nil, err
+			}
+			executions = append(executions, recent...)
+		}
+
+		for _, execution := range executions {
+			if execution.Application == "" {
+				execution.Application = application
+			}
+			pipelineExecutions = append(pipelineExecutions, execution)
+		}
+	}
+	return pipelineExecutions, nil
+}
+
+// sortExecutions drops the executions that were returned twice, e.g. because
+// they moved between pages while paging, and orders the rest oldest first,
+// breaking ties on the ID so that every check agrees on the order
+func sortExecutions(pes []spinnaker.PipelineExecution, orderKey func(spinnaker.PipelineExecution) uint64) []spinnaker.PipelineExecution {
+	seen := map[string]bool{}
+	pe := make([]spinnaker.PipelineExecution, 0, len(pes))
+	for _, pipeExec := range pes {
+		if !seen[pipeExec.ID] {
+			seen[pipeExec.ID] = true
+			pe = append(pe, pipeExec)
+		}
+	}
+
+	sort.Slice(pe, func(i, j int) bool {
+		if orderKey(pe[i]) != orderKey(pe[j]) {
+			return orderKey(pe[i]) < orderKey(pe[j])
+		}
+		return pe[i].ID < pe[j].ID
 	})
+	return pe
+}
 
-	refLoc := len(pipelineExecutions) - 1
-	for i, execution := range pipelineExecutions {
-		if execution.ID == request.Version.Ref {
-			refLoc = i
-			break
+// newExecutions returns the previously emitted version followed by every
+// execution since. When that version is no longer emitted, e.g. because the
+// filters changed, every execution ordered at or after it is returned, and
+// without a previous version only the latest execution.
+func newExecutions(pes []spinnaker.PipelineExecution, ref string, previous *spinnaker.PipelineExecution, orderKey func(spinnaker.PipelineExecution) uint64) []spinnaker.PipelineExecution {
+	for i, pipeExec := range pes {
+		if pipeExec.ID == ref {
+			return pes[i:]
 		}
 	}
+	if previous == nil {
+		return pes[len(pes)-1:]
+	}
 
-	//loop from the input execution onwards loop will just use the last element if input execution is not found
-	var res concourse.CheckResponse
-	responseExecutions := pipelineExecutions[refLoc:]
-	for _, execution := range responseExecutions {
-		res = append(res, concourse.Version{Ref: execution.ID})
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		if orderKey(pipeExec) >= orderKey(*previous) {
+			pe = append(pe, pipeExec)
+		}
 	}
-	concourse.WriteResponse(res)
+	return pe
 }
 
-func filterName(name string, pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+// transitionsSince returns every execution that changed status since the
+// previous version was emitted, including the execution of that version
+// itself once it has moved on from the status it was emitted with
+func transitionsSince(pes []spinnaker.PipelineExecution, version concourse.Version, previous *spinnaker.PipelineExecution, orderKey func(spinnaker.PipelineExecution) uint64) []spinnaker.PipelineExecution {
+	if previous == nil {
+		return newExecutions(pes, version.Ref, previous, orderKey)
+	}
+
+	emitted := *previous
+	if spinnaker.ActiveStatus(version.Status) {
+		//it was emitted before it ended
+		emitted.EndTime = 0
+	}
+	since := orderKey(emitted)
+
 	pe := make([]spinnaker.PipelineExecution, 0)
 	for _, pipeExec := range pes {
-		if pipeExec.Name == name {
+		if orderKey(pipeExec) >= since {
+			pe = append(pe, pipeExec)
+		}
+	}
+	return pe
+}
+
+func filterName(names []string, regex *regexp.Regexp, pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		if matchName(pipeExec.Name, names, regex) {
+			pe = append(pe, pipeExec)
+		}
+	}
+	return pe
+}
+
+func matchName(name string, names []string, regex *regexp.Regexp) bool {
+	if regex != nil && regex.MatchString(name) {
+		return true
+	}
+	for _, currName := range names {
+		if name == currName {
+			return true
+		}
+	}
+	return false
+}
+
+func filterExecutionName(regex *regexp.Regexp, pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	if regex == nil {
+		return pes
+	}
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		if regex.MatchString(pipeExec.Name) {
 			pe = append(pe, pipeExec)
 		}
 	}
@@ -75,7 +404,8 @@ func checkStatus(status string, statuses []string) bool {
 		return true
 	}
 	for _, currStatus := range statuses {
-		if status == currStatus {
+		//Spinnaker statuses are upper case, but the examples have long used lower case ones
+		if strings.EqualFold(status, currStatus) {
 			return true
 		}
 	}
@@ -91,3 +421,156 @@ func filterStatus(statuses []string, pes []spinnaker.PipelineExecution) []spinna
 	}
 	return pe
 }
+
+// filterCanceled drops the canceled executions, including the ones that were
+// canceled while a stage was failing and so ended up TERMINAL
+func filterCanceled(pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		if !pipeExec.Canceled && !strings.EqualFold(pipeExec.Status, "CANCELED") {
+			pe = append(pe, pipeExec)
+		}
+	}
+	return pe
+}
+
+// filterTriggeredSince drops the executions triggered before the
+// initial_max_age boundary, which older Gates leave in the search results
+func filterTriggeredSince(boundary uint64, pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		if pipeExec.BuildTime >= boundary {
+			pe = append(pe, pipeExec)
+		}
+	}
+	return pe
+}
+
+func filterTriggerType(triggerTypes []string, pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	if len(triggerTypes) == 0 {
+		return pes
+	}
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		for _, triggerType := range triggerTypes {
+			if strings.EqualFold(pipeExec.Trigger.Type, triggerType) {
+				pe = append(pe, pipeExec)
+				break
+			}
+		}
+	}
+	return pe
+}
+
+// filterTriggerUser keeps the executions triggered by one of the users, if
+// any are configured, and drops the ones triggered by an ignored user
+func filterTriggerUser(users, ignoredUsers []string, pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		if len(users) > 0 && !containsFold(users, pipeExec.Trigger.User) {
+			continue
+		}
+		if containsFold(ignoredUsers, pipeExec.Trigger.User) {
+			continue
+		}
+		pe = append(pe, pipeExec)
+	}
+	return pe
+}
+
+func containsFold(values []string, value string) bool {
+	for _, currValue := range values {
+		if strings.EqualFold(currValue, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterParameters keeps the executions whose trigger parameters hold every
+// configured value. Parameters can be numbers or booleans in the trigger, so
+// values are compared in their string form.
+func filterParameters(parameters map[string]string, pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	if len(parameters) == 0 {
+		return pes
+	}
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		if matchParameters(parameters, pipeExec.Trigger.Parameters) {
+			pe = append(pe, pipeExec)
+		}
+	}
+	return pe
+}
+
+func matchParameters(expected map[string]string, actual map[string]interface{}) bool {
+	for key, value := range expected {
+		actualValue, ok := actual[key]
+		if !ok || fmt.Sprint(actualValue) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// filterRequiredStage keeps the executions in which the named stage finished
+// with the required status, SUCCEEDED unless configured otherwise
+func filterRequiredStage(required concourse.RequiredStage, pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	if required.Name == "" {
+		return pes
+	}
+	status := required.Status
+	if status == "" {
+		status = "SUCCEEDED"
+	}
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		for _, stage := range pipeExec.Stages {
+			if stage.Name == required.Name && strings.EqualFold(stage.Status, status) {
+				pe = append(pe, pipeExec)
+				break
+			}
+		}
+	}
+	return pe
+}
+
+// filterArtifact keeps the executions whose trigger brought in an artifact of
+// the type whose name and version match, when any of them is configured
+func filterArtifact(artifactType string, name, version *regexp.Regexp, pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	if artifactType == "" && name == nil && version == nil {
+		return pes
+	}
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		for _, artifact := range pipeExec.Trigger.Artifacts {
+			if (artifactType == "" || strings.EqualFold(artifact.Type, artifactType)) &&
+				(name == nil || name.MatchString(artifact.Name)) &&
+				(version == nil || version.MatchString(artifact.Version)) {
+				pe = append(pe, pipeExec)
+				break
+			}
+		}
+	}
+	return pe
+}
+
+func filterEnded(pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		if pipeExec.EndTime != 0 {
+			pe = append(pe, pipeExec)
+		}
+	}
+	return pe
+}
+
+func filterTriggeredBy(source concourse.Source, pes []spinnaker.PipelineExecution) []spinnaker.PipelineExecution {
+	pe := make([]spinnaker.PipelineExecution, 0)
+	for _, pipeExec := range pes {
+		if spinnaker.TriggeredBy(source, pipeExec) {
+			pe = append(pe, pipeExec)
+		}
+	}
+	return pe
+}
@@ -0,0 +1,97 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+// the artifact types Gate can fetch the contents of; docker images and the
+// like only have a reference
+var fetchableArtifactTypes = map[string]bool{
+	"http/file":  true,
+	"gcs/object": true,
+	"s3/object":  true,
+}
+
+// downloadArtifacts writes the contents of the artifacts the stages of the
+// execution produced to artifacts/<index>-<name>, and lists every produced
+// artifact in artifacts.json
+func downloadArtifacts(ctx context.Context, spinClient spinnaker.SpinClient, dest string, execution []byte) error {
+	var stages struct {
+		Stages []struct {
+			Outputs struct {
+				Artifacts []json.RawMessage `json:"artifacts"`
+			} `json:"outputs"`
+		} `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+
+	artifactsDir := filepath.Join(dest, "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		return err
+	}
+	produced := []json.RawMessage{}
+	for _, stage := range stages.Stages {
+		produced = append(produced, stage.Outputs.Artifacts...)
+	}
+	for i, rawArtifact := range produced {
+		var artifact spinnaker.Artifact
+		if err := json.Unmarshal(rawArtifact, &artifact); err != nil {
+			return err
+		}
+		fileName := filepath.Join(artifactsDir, artifactFileName(i, artifact.Name))
+
+		switch {
+		case artifact.Type == "embedded/base64":
+			contents, err := base64.StdEncoding.DecodeString(artifact.Reference)
+			if err != nil {
+				return fmt.Errorf("decoding artifact %s: %s", artifact.Name, err)
+			}
+			if err := ioutil.WriteFile(fileName, contents, 0644); err != nil {
+				return err
+			}
+		case fetchableArtifactTypes[artifact.Type]:
+			if err := fetchArtifact(ctx, spinClient, rawArtifact, fileName); err != nil {
+				return fmt.Errorf("fetching artifact %s: %s", artifact.Name, err)
+			}
+		default:
+			concourse.Sayf("Skipping the download of %s artifact %s\n", artifact.Type, artifact.Name)
+		}
+	}
+	return writeJSON(filepath.Join(dest, "artifacts.json"), produced)
+}
+
+func fetchArtifact(ctx context.Context, spinClient spinnaker.SpinClient, artifact []byte, fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return spinClient.FetchArtifact(ctx, artifact, file)
+}
+
+// artifactFileName names the file after the last element of the artifact
+// name, which is usually a URL or bucket path
+func artifactFileName(index int, name string) string {
+	return fmt.Sprintf("%d-%s", index, unsafeFileChars.ReplaceAllString(path.Base(name), "-"))
+}
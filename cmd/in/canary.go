@@ -0,0 +1,91 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+type canaryScores struct {
+	Stage   string      `json:"stage"`
+	Status  string      `json:"status"`
+	Scores  interface{} `json:"scores"`
+	Message string      `json:"message,omitempty"`
+}
+
+// writeCanaryResults writes the scores of the canary analysis stages of the
+// execution to canary/scores.json, and the judgment of each analysis Kayenta
+// ran to canary/<canary execution id>.json. Executions without canary
+// analysis stages get no canary directory, and judgments Kayenta can't return
+// are skipped with a warning.
+func writeCanaryResults(ctx context.Context, spinClient spinnaker.SpinClient, dest string, execution []byte) error {
+	var stages struct {
+		Stages []struct {
+			Name    string `json:"name"`
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Context struct {
+				CanaryScores              interface{} `json:"canaryScores"`
+				CanaryScoreMessage        string      `json:"canaryScoreMessage"`
+				CanaryPipelineExecutionID string      `json:"canaryPipelineExecutionId"`
+			} `json:"context"`
+		} `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+
+	scores := []canaryScores{}
+	var canaryExecutionIDs []string
+	for _, stage := range stages.Stages {
+		switch stage.Type {
+		case "kayentaCanary":
+			scores = append(scores, canaryScores{
+				Stage:   stage.Name,
+				Status:  stage.Status,
+				Scores:  stage.Context.CanaryScores,
+				Message: stage.Context.CanaryScoreMessage,
+			})
+		case "runCanary":
+			if stage.Context.CanaryPipelineExecutionID != "" {
+				canaryExecutionIDs = append(canaryExecutionIDs, stage.Context.CanaryPipelineExecutionID)
+			}
+		}
+	}
+	if len(scores) == 0 && len(canaryExecutionIDs) == 0 {
+		return nil
+	}
+
+	canaryDir := filepath.Join(dest, "canary")
+	if err := os.MkdirAll(canaryDir, 0755); err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(canaryDir, "scores.json"), scores); err != nil {
+		return err
+	}
+	for _, id := range canaryExecutionIDs {
+		//the execution is still worth getting while Kayenta is down or purged the result
+		judgment, err := spinClient.GetCanaryResult(ctx, id)
+		if err != nil {
+			concourse.Sayf("Failed to fetch the judgment of canary %s: %s\n", id, err)
+			continue
+		}
+		if err := writeRawJSON(filepath.Join(canaryDir, unsafeFileChars.ReplaceAllString(id, "-")+".json"), judgment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+// writeChildren writes the executions the Pipeline stages of the execution
+// launched to children/<index>-<name>/metadata.json, along with their own
+// children, so the whole tree of nested pipelines is on disk. Their stages
+// are redacted and trimmed like the ones of the execution.
+func writeChildren(ctx context.Context, spinClient spinnaker.SpinClient, dest string, execution []byte, params concourse.InParams, visited map[string]bool) error {
+	var stages struct {
+		Stages []struct {
+			Name    string `json:"name"`
+			Type    string `json:"type"`
+			Context struct {
+				ExecutionID string `json:"executionId"`
+			} `json:"context"`
+		} `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+
+	for i, stage := range stages.Stages {
+		childID := stage.Context.ExecutionID
+		//a pipeline stage may launch the pipeline it is in, which is only fetched once
+		if stage.Type != "pipeline" || childID == "" || visited[childID] {
+			continue
+		}
+		visited[childID] = true
+
+		child, err := spinClient.GetPipelineExecutionRaw(ctx, childID)
+		if err != nil {
+			return err
+		}
+		child, err = redactStages(child, params.RedactContextKeys)
+		if err != nil {
+			return err
+		}
+		trimmed, err := trimContexts(child, params.MaxContextSize)
+		if err != nil {
+			return err
+		}
+		childDir := filepath.Join(dest, "children", strings.TrimSuffix(stageFileName(i, stage.Name), ".json"))
+		if err := os.MkdirAll(childDir, 0755); err != nil {
+			return err
+		}
+		if err := writeExecutionJSON(filepath.Join(childDir, "metadata.json"), trimmed); err != nil {
+			return err
+		}
+		if err := writeChildren(ctx, spinClient, childDir, child, params, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const redacted = "**REDACTED**"
+
+// redactStages replaces the values of the redact_context_keys anywhere in the
+// contexts and outputs of the stages, since some executions embed secrets in
+// them. Every file is written from the redacted execution. The execution is
+// returned as it is when no keys are set.
+func redactStages(execution []byte, keys []string) ([]byte, error) {
+	if len(keys) == 0 {
+		return execution, nil
+	}
+	redactKeys := map[string]bool{}
+	for _, key := range keys {
+		redactKeys[key] = true
+	}
+	return updateStages(execution, func(stage map[string]interface{}) error {
+		for _, field := range []string{"context", "outputs"} {
+			if value, ok := stage[field]; ok {
+				stage[field] = redact(value, redactKeys)
+			}
+		}
+		return nil
+	})
+}
+
+// trimContexts replaces the stage contexts larger than max_context_size with
+// a note of their size, since some executions embed whole manifests in them.
+// The execution is returned as it is when no size is set.
+func trimContexts(execution []byte, maxSize int) ([]byte, error) {
+	if maxSize <= 0 {
+		return execution, nil
+	}
+	return updateStages(execution, func(stage map[string]interface{}) error {
+		context, ok := stage["context"]
+		if !ok {
+			return nil
+		}
+		encoded, err := json.Marshal(context)
+		if err != nil {
+			return err
+		}
+		if len(encoded) > maxSize {
+			stage["context"] = map[string]interface{}{"trimmedContextSize": len(encoded)}
+		}
+		return nil
+	})
+}
+
+// updateStages applies update to every stage of the execution
+func updateStages(execution []byte, update func(stage map[string]interface{}) error) ([]byte, error) {
+	var document map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(execution))
+	//keep ids and timestamps as they are instead of rounding them to float64
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	stages, _ := document["stages"].([]interface{})
+	for _, stage := range stages {
+		stage, ok := stage.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := update(stage); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(document)
+}
+
+func redact(value interface{}, keys map[string]bool) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			if keys[key] {
+				value[key] = redacted
+			} else {
+				value[key] = redact(nested, keys)
+			}
+		}
+	case []interface{}:
+		for i, nested := range value {
+			value[i] = redact(nested, keys)
+		}
+	}
+	return value
+}
@@ -0,0 +1,157 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+type serverGroup struct {
+	Stage         string `json:"stage"`
+	Account       string `json:"account,omitempty"`
+	CloudProvider string `json:"cloudProvider,omitempty"`
+	Region        string `json:"region"`
+	Name          string `json:"name"`
+}
+
+type deployStage struct {
+	Name    string                 `json:"name"`
+	Context map[string]interface{} `json:"context"`
+	Outputs map[string]interface{} `json:"outputs"`
+}
+
+// writeDeployments writes the server groups the deploy stages of the
+// execution created to server_groups.json, and the Kubernetes manifests they
+// deployed to manifests.json and one file each in manifests/
+func writeDeployments(dest string, execution []byte) error {
+	var stages struct {
+		Stages []deployStage `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+
+	serverGroups := []serverGroup{}
+	manifests := []map[string]interface{}{}
+	for _, stage := range stages.Stages {
+		serverGroups = append(serverGroups, stageServerGroups(stage)...)
+		manifests = append(manifests, stageManifests(stage)...)
+	}
+
+	if err := writeJSON(filepath.Join(dest, "server_groups.json"), serverGroups); err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(dest, "manifests.json"), manifests); err != nil {
+		return err
+	}
+	manifestsDir := filepath.Join(dest, "manifests")
+	if err := os.MkdirAll(manifestsDir, 0755); err != nil {
+		return err
+	}
+	for i, manifest := range manifests {
+		if err := writeJSON(filepath.Join(manifestsDir, manifestFileName(i, manifest)), manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type taggedServerGroup struct {
+	serverGroup
+	EntityTags json.RawMessage `json:"entityTags"`
+}
+
+// writeEntityTags writes the entity tags of the server groups the deploy
+// stages of the execution created to entity_tags.json, for audit pipelines
+// checking them against tagging policies
+func writeEntityTags(ctx context.Context, spinClient spinnaker.SpinClient, dest string, execution []byte) error {
+	var stages struct {
+		Stages []deployStage `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+
+	tagged := []taggedServerGroup{}
+	for _, stage := range stages.Stages {
+		for _, group := range stageServerGroups(stage) {
+			tags, err := spinClient.GetEntityTags(ctx, "servergroup", group.Name, group.Account, group.Region)
+			if err != nil {
+				return err
+			}
+			tagged = append(tagged, taggedServerGroup{serverGroup: group, EntityTags: tags})
+		}
+	}
+	return writeJSON(filepath.Join(dest, "entity_tags.json"), tagged)
+}
+
+// stageServerGroups reads the deploy.server.groups context Orca records as a
+// map of region to the names of the server groups created in it
+func stageServerGroups(stage deployStage) []serverGroup {
+	groupsByRegion, _ := stage.Context["deploy.server.groups"].(map[string]interface{})
+	regions := make([]string, 0, len(groupsByRegion))
+	for region := range groupsByRegion {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	account, _ := stage.Context["account"].(string)
+	if account == "" {
+		account, _ = stage.Context["credentials"].(string)
+	}
+	cloudProvider, _ := stage.Context["cloudProvider"].(string)
+
+	var serverGroups []serverGroup
+	for _, region := range regions {
+		names, _ := groupsByRegion[region].([]interface{})
+		for _, name := range names {
+			if name, ok := name.(string); ok {
+				serverGroups = append(serverGroups, serverGroup{
+					Stage:         stage.Name,
+					Account:       account,
+					CloudProvider: cloudProvider,
+					Region:        region,
+					Name:          name,
+				})
+			}
+		}
+	}
+	return serverGroups
+}
+
+// stageManifests reads the manifests a Deploy (Manifest) stage deployed, which
+// Orca outputs as outputs.manifests
+func stageManifests(stage deployStage) []map[string]interface{} {
+	rawManifests, ok := stage.Outputs["outputs.manifests"].([]interface{})
+	if !ok {
+		rawManifests, _ = stage.Context["outputs.manifests"].([]interface{})
+	}
+	var manifests []map[string]interface{}
+	for _, manifest := range rawManifests {
+		if manifest, ok := manifest.(map[string]interface{}); ok {
+			manifests = append(manifests, manifest)
+		}
+	}
+	return manifests
+}
+
+func manifestFileName(index int, manifest map[string]interface{}) string {
+	kind, _ := manifest["kind"].(string)
+	metadata, _ := manifest["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return fmt.Sprintf("%d-%s-%s.json", index, unsafeFileChars.ReplaceAllString(kind, "-"), unsafeFileChars.ReplaceAllString(name, "-"))
+}
@@ -0,0 +1,87 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/PaesslerAG/gval"
+	"github.com/PaesslerAG/jsonpath"
+)
+
+// extractLanguage is JSONPath with filter expressions, and with the single
+// quoted strings of the usual ['name'] and [?(@.name=='value')] forms, which
+// gval otherwise parses as Go character literals.
+var extractLanguage = gval.NewLanguage(
+	gval.Full(),
+	jsonpath.Language(),
+	gval.PrefixExtension(scanner.Char, singleQuoted),
+)
+
+func singleQuoted(c context.Context, p *gval.Parser) (gval.Evaluable, error) {
+	text := p.TokenText()
+	unescaped := strings.NewReplacer(`\'`, `'`, `"`, `\"`).Replace(text[1 : len(text)-1])
+	s, err := strconv.Unquote(`"` + unescaped + `"`)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse string %s: %s", text, err)
+	}
+	return p.Const(s), nil
+}
+
+// writeExtracts evaluates each JSONPath expression against the execution and
+// writes its result to extract/<key>. Strings are written as they are, other
+// results as JSON. Expressions with wildcards, slices, filters or recursive
+// descent result in the array of their matches, the others in the value they
+// point to.
+func writeExtracts(dest string, execution []byte, extracts map[string]string) error {
+	var root interface{}
+	if err := json.Unmarshal(execution, &root); err != nil {
+		return err
+	}
+
+	extractDir := filepath.Join(dest, "extract")
+	if err := os.MkdirAll(extractDir, 0755); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(extracts))
+	for key := range extracts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	files := fileNames(keys)
+	for _, key := range keys {
+		expr := extracts[key]
+		path, err := extractLanguage.NewEvaluable(expr)
+		if err != nil {
+			return fmt.Errorf("extract %s: %s", key, err)
+		}
+		result, err := path(context.Background(), root)
+		if err != nil {
+			return fmt.Errorf("extract %s: %s matched nothing: %s", key, expr, err)
+		}
+		value, err := paramValue(result)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(extractDir, files[key]), []byte(value), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
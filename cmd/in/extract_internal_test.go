@@ -0,0 +1,81 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+const extractExecution = `{
+	"id": "EX1",
+	"status": "SUCCEEDED",
+	"trigger": {"type": "concourse", "parameters": {"version": "1.4.2", "it's": "quoted"}},
+	"stages": [
+		{"name": "Bake", "status": "SUCCEEDED", "order": 1, "outputs": {"image": "app:1.4.2"}},
+		{"name": "Deploy", "status": "SUCCEEDED", "order": 2, "outputs": {"deployedArtifacts": [{"name": "app"}]}},
+		{"name": "Verify 'smoke'", "status": "TERMINAL", "order": 3}
+	]
+}`
+
+var _ = Describe("writeExtracts", func() {
+	var dest string
+
+	BeforeEach(func() {
+		var err error
+		dest, err = ioutil.TempDir("", "extract")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dest)
+	})
+
+	DescribeTable("writes the result of each expression",
+		func(expr, expected string) {
+			Expect(writeExtracts(dest, []byte(extractExecution), map[string]string{"result": expr})).To(Succeed())
+
+			actual, err := ioutil.ReadFile(filepath.Join(dest, "extract", "result"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(actual)).To(Equal(expected))
+		},
+		Entry("a string as it is", "$.trigger.parameters.version", "1.4.2"),
+		Entry("other values as JSON", "$.stages[1].outputs", `{"deployedArtifacts":[{"name":"app"}]}`),
+		Entry("single quoted names", `$['trigger']['parameters']["version"]`, "1.4.2"),
+		Entry("escaped quotes", `$.trigger.parameters['it\'s']`, "quoted"),
+		Entry("the matches of a wildcard", "$.stages[*].order", "[1,2,3]"),
+		Entry("the matches of a recursive name", "$..deployedArtifacts[0].name", `["app"]`),
+		Entry("the matches of a filter", "$.stages[?(@.name=='Verify \\'smoke\\'')].status", `["TERMINAL"]`),
+		Entry("the matches of a comparison", `$.stages[?(@.order >= 2 && @.status == "SUCCEEDED")].name`, `["Deploy"]`),
+		Entry("no matches", "$.stages[?(@.status == 'CANCELED')].name", "[]"),
+	)
+
+	It("names the files like the params", func() {
+		Expect(writeExtracts(dest, []byte(extractExecution), map[string]string{"a b": "$.id", "a-b": "$.status"})).To(Succeed())
+
+		Expect(filepath.Join(dest, "extract", "a-b")).To(BeARegularFile())
+		Expect(filepath.Join(dest, "extract", "a-b-2")).To(BeARegularFile())
+	})
+
+	It("fails when a path points to nothing", func() {
+		err := writeExtracts(dest, []byte(extractExecution), map[string]string{"user": "$.trigger.user"})
+		Expect(err).To(MatchError(ContainSubstring("extract user: $.trigger.user matched nothing")))
+	})
+
+	It("fails when an expression is malformed", func() {
+		err := writeExtracts(dest, []byte(extractExecution), map[string]string{"stage": "$.stages[?(@.name=='Bake)]"})
+		Expect(err).To(MatchError(ContainSubstring("extract stage: parsing error")))
+	})
+})
@@ -0,0 +1,80 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+)
+
+type bakedImage struct {
+	Stage         string `json:"stage"`
+	CloudProvider string `json:"cloudProvider,omitempty"`
+	Region        string `json:"region,omitempty"`
+	ImageID       string `json:"imageId"`
+	ImageName     string `json:"imageName,omitempty"`
+}
+
+// writeImages lists the images the bake stages of the execution produced, AMIs,
+// GCE images or docker digests, in images.json and their IDs in images.txt
+func writeImages(dest string, execution []byte) error {
+	var stages struct {
+		Stages []struct {
+			Name    string `json:"name"`
+			Type    string `json:"type"`
+			Context struct {
+				CloudProvider     string `json:"cloudProvider"`
+				CloudProviderType string `json:"cloudProviderType"`
+				Region            string `json:"region"`
+				ImageID           string `json:"imageId"`
+				AMI               string `json:"ami"`
+				ImageName         string `json:"imageName"`
+			} `json:"context"`
+		} `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+
+	images := []bakedImage{}
+	ids := ""
+	//the parent and per-region child stages of a multi-region bake can report the same image
+	seen := map[string]bool{}
+	for _, stage := range stages.Stages {
+		if stage.Type != "bake" {
+			continue
+		}
+		image := bakedImage{
+			Stage:         stage.Name,
+			CloudProvider: stage.Context.CloudProviderType,
+			Region:        stage.Context.Region,
+			ImageID:       stage.Context.ImageID,
+			ImageName:     stage.Context.ImageName,
+		}
+		if image.CloudProvider == "" {
+			image.CloudProvider = stage.Context.CloudProvider
+		}
+		if image.ImageID == "" {
+			image.ImageID = stage.Context.AMI
+		}
+		if image.ImageID == "" || seen[image.Region+"/"+image.ImageID] {
+			continue
+		}
+		seen[image.Region+"/"+image.ImageID] = true
+		images = append(images, image)
+		ids += image.ImageID + "\n"
+	}
+
+	if err := writeJSON(filepath.Join(dest, "images.json"), images); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dest, "images.txt"), []byte(ids), 0644)
+}
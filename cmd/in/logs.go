@@ -0,0 +1,86 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+// writeLogs writes the logs of the pods the Kubernetes Run Job stages of the
+// execution ran to logs/<index>-<name>.log. Gate has no logs of Titus jobs
+// or Script stages, which are only reported.
+func writeLogs(ctx context.Context, spinClient spinnaker.SpinClient, dest string, execution []byte) error {
+	var stages struct {
+		Application string `json:"application"`
+		Stages      []struct {
+			Name    string `json:"name"`
+			Type    string `json:"type"`
+			Context struct {
+				CloudProvider string `json:"cloudProvider"`
+				Account       string `json:"account"`
+				JobStatus     struct {
+					Location string `json:"location"`
+					Pods     []struct {
+						Name string `json:"name"`
+					} `json:"pods"`
+				} `json:"jobStatus"`
+			} `json:"context"`
+		} `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+	//the pods are looked up in the application of the execution
+	if stages.Application != "" {
+		spinClient = spinClient.ForApplication(stages.Application)
+	}
+
+	logsDir := filepath.Join(dest, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		return err
+	}
+	for i, stage := range stages.Stages {
+		if stage.Type != "runJob" && stage.Type != "script" {
+			continue
+		}
+		if stage.Type == "script" || stage.Context.CloudProvider != "kubernetes" {
+			concourse.Sayf("Skipping the logs of %s stage %s, Gate doesn't serve them\n", stage.Type, stage.Name)
+			continue
+		}
+
+		var logs bytes.Buffer
+		for _, pod := range stage.Context.JobStatus.Pods {
+			podLogs, err := spinClient.GetPodLogs(ctx, stage.Context.Account, stage.Context.JobStatus.Location, pod.Name)
+			if err != nil {
+				return fmt.Errorf("fetching the logs of pod %s: %s", pod.Name, err)
+			}
+			//jobs with retries run several pods, tell their logs apart
+			if len(stage.Context.JobStatus.Pods) > 1 {
+				fmt.Fprintf(&logs, "==> %s <==\n", pod.Name)
+			}
+			logs.Write(podLogs)
+		}
+		fileName := strings.TrimSuffix(stageFileName(i, stage.Name), ".json") + ".log"
+		if err := ioutil.WriteFile(filepath.Join(logsDir, fileName), logs.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
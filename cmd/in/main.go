@@ -6,10 +6,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/metrics"
 	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+	"github.com/pivotal-cf/spinnaker-resource/tracing"
 )
 
 func main() {
@@ -21,24 +24,74 @@ func main() {
 	var request concourse.InRequest
 	concourse.ReadRequest(&request)
 
-	spinClient, err := spinnaker.NewClient(request.Source)
+	transport, err := spinnaker.NewTransport(request.Source)
 	if err != nil {
 		concourse.Fatal("get step failed", err)
 	}
+	metrics.Setup(request.Source, "in", transport)
+	tracing.Setup(request.Source, "in", transport)
+	tracing.SetAttribute("spinnaker.execution.id", request.Version.Ref)
 
-	res, err := spinClient.GetPipelineExecutionRaw(request.Version.Ref)
+	dest := os.Args[1]
+
+	//jobs only getting the version for passed constraints don't need the
+	//execution, and the version of a dry_run put has none
+	dryRun := request.Version.Ref == concourse.DryRunRef
+	if request.Params.SkipDownload || dryRun {
+		err := ioutil.WriteFile(filepath.Join(dest, "version"), []byte(request.Version.Ref), 0644)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+		metadata := []concourse.InResponseMetadata{}
+		if dryRun {
+			err = ioutil.WriteFile(filepath.Join(dest, "dry_run"), []byte("true"), 0644)
+			if err != nil {
+				concourse.Fatal("get step failed", err)
+			}
+			metadata = append(metadata, concourse.InResponseMetadata{Name: "Dry run", Value: "true"})
+		}
+		concourse.WriteResponse(concourse.InResponse{
+			Version:  request.Version,
+			Metadata: metadata,
+		})
+	}
+
+	err = setJSONFormat(request.Params.JSONFormat)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+	err = setCompression(request.Params.Compress)
 	if err != nil {
 		concourse.Fatal("get step failed", err)
 	}
 
-	dest := os.Args[1]
+	ctx, cancel := concourse.SignalContext()
+	defer cancel()
 
-	err = ioutil.WriteFile(filepath.Join(dest, "metadata.json"), res, 0644)
+	spinClient, err := spinnaker.NewReadClient(ctx, request.Source)
 	if err != nil {
 		concourse.Fatal("get step failed", err)
 	}
+	request.Source = spinClient.Source()
+
+	//systems that triggered the pipeline themselves may only know the eventId
+	//they supplied, the version asked for is still the one emitted
+	executionID := request.Version.Ref
+	if request.Params.EventID != "" {
+		execution, err := spinClient.GetPipelineExecutionByEventID(ctx, request.Params.EventID)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+		executionID = execution.ID
+		tracing.SetAttribute("spinnaker.execution.id", executionID)
+	}
 
-	err = ioutil.WriteFile(filepath.Join(dest, "version"), []byte(request.Version.Ref), 0644)
+	var res []byte
+	if request.Params.Wait {
+		res, err = waitForCompletion(ctx, spinClient, request.Source, request.Params, executionID)
+	} else {
+		res, err = spinClient.GetPipelineExecutionRaw(ctx, executionID)
+	}
 	if err != nil {
 		concourse.Fatal("get step failed", err)
 	}
@@ -49,6 +102,148 @@ func main() {
 		concourse.Fatal("get step failed", err)
 	}
 
+	err = verifyExecution(request.Source, metaData, request.Version)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+
+	res, err = redactStages(res, request.Params.RedactContextKeys)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+	//the other files are extracted from the whole contexts
+	trimmed, err := trimContexts(res, request.Params.MaxContextSize)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+
+	err = writeExecutionJSON(filepath.Join(dest, "metadata.json"), trimmed)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dest, "version"), []byte(executionID), 0644)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+
+	err = writeStages(dest, trimmed)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+
+	err = writeParams(dest, res)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+
+	err = writeTrigger(dest, res)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+
+	err = writeCanaryResults(ctx, spinClient, dest, res)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+
+	if request.Params.Outputs {
+		err = writeOutputs(dest, res)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if request.Params.DownloadArtifacts {
+		err = downloadArtifacts(ctx, spinClient, dest, res)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if request.Params.Images {
+		err = writeImages(dest, res)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if request.Params.Deployments {
+		err = writeDeployments(dest, res)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if request.Params.EntityTags {
+		err = writeEntityTags(ctx, spinClient, dest, res)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if request.Params.Logs {
+		err = writeLogs(ctx, spinClient, dest, res)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if request.Params.JUnit {
+		err = writeJUnit(dest, res)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if request.Params.Timeline {
+		err = writeTimeline(dest, res, executionID)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if request.Params.Variables {
+		err = writeVariables(dest, res)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if request.Params.Webhooks {
+		err = writeWebhooks(dest, res)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if len(request.Params.Extract) > 0 {
+		err = writeExtracts(dest, res, request.Params.Extract)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	if request.Params.Children {
+		err = writeChildren(ctx, spinClient, dest, res, request.Params, map[string]bool{executionID: true})
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	executionURL := request.Source.ExecutionURL(metaData.ApplicationName, executionID)
+	if executionURL != "" {
+		err = ioutil.WriteFile(filepath.Join(dest, "url"), []byte(executionURL), 0644)
+		if err != nil {
+			concourse.Fatal("get step failed", err)
+		}
+	}
+
+	err = writeSummary(dest, res, executionID, executionURL)
+	if err != nil {
+		concourse.Fatal("get step failed", err)
+	}
+
 	resArr := []concourse.InResponseMetadata{
 		concourse.InResponseMetadata{
 			Name:  "Application Name",
@@ -72,6 +267,31 @@ func main() {
 		},
 	}
 
+	if metaData.StartTime > 0 && metaData.EndTime >= metaData.StartTime {
+		resArr = append(resArr, concourse.InResponseMetadata{
+			Name:  "Duration",
+			Value: (time.Duration(metaData.EndTime-metaData.StartTime) * time.Millisecond).String(),
+		})
+	}
+	if metaData.Trigger.User != "" {
+		resArr = append(resArr, concourse.InResponseMetadata{
+			Name:  "Triggered by",
+			Value: metaData.Trigger.User,
+		})
+	}
+	if failedStages := failedStageNames(metaData); len(failedStages) > 0 {
+		resArr = append(resArr, concourse.InResponseMetadata{
+			Name:  "Failed stages",
+			Value: strings.Join(failedStages, ", "),
+		})
+	}
+	if executionURL != "" {
+		resArr = append(resArr, concourse.InResponseMetadata{
+			Name:  "URL",
+			Value: executionURL,
+		})
+	}
+
 	InResponse := concourse.InResponse{
 		Version:  request.Version,
 		Metadata: resArr,
@@ -80,3 +300,42 @@ func main() {
 	concourse.WriteResponse(InResponse)
 
 }
+
+func failedStageNames(metaData concourse.IntermediateMetadata) []string {
+	var names []string
+	for _, stage := range metaData.Stages {
+		//FAILED_CONTINUE stages failed without failing the pipeline
+		if stage.Status == "TERMINAL" || stage.Status == "FAILED_CONTINUE" {
+			names = append(names, stage.Name)
+		}
+	}
+	return names
+}
+
+// verifyExecution makes sure the execution belongs to one of the applications
+// and pipelines of the source, or to the ones the version tells, so versions
+// passed between mis-configured resources don't silently fetch another
+// pipeline's execution. Puts triggering another pipeline than the source's
+// tell it in the version.
+func verifyExecution(source concourse.Source, metaData concourse.IntermediateMetadata, version concourse.Version) error {
+	if version.Application == "" || version.Application != metaData.ApplicationName {
+		watched, err := source.WatchesApplication(metaData.ApplicationName)
+		if err != nil {
+			return err
+		}
+		if !watched {
+			return fmt.Errorf("execution %s belongs to application %s, which is not configured in the source", version.Ref, metaData.ApplicationName)
+		}
+	}
+
+	if version.Pipeline == "" || version.Pipeline != metaData.PipelineName {
+		watched, err := source.WatchesPipeline(metaData.PipelineName)
+		if err != nil {
+			return err
+		}
+		if !watched {
+			return fmt.Errorf("execution %s belongs to pipeline %s, which is not configured in the source", version.Ref, metaData.PipelineName)
+		}
+	}
+	return nil
+}
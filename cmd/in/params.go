@@ -0,0 +1,158 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var unsafeEnvChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// writeParams writes each trigger parameter of the execution to
+// params/<name>, and all of them to params.env as shell exports tasks can source
+func writeParams(dest string, execution []byte) error {
+	var trigger struct {
+		Trigger struct {
+			Parameters map[string]interface{} `json:"parameters"`
+		} `json:"trigger"`
+	}
+	if err := json.Unmarshal(execution, &trigger); err != nil {
+		return err
+	}
+	parameters := trigger.Trigger.Parameters
+
+	paramsDir := filepath.Join(dest, "params")
+	if err := os.MkdirAll(paramsDir, 0755); err != nil {
+		return err
+	}
+	names := sortedNames(parameters)
+	files := fileNames(names)
+	for _, name := range names {
+		value, err := paramValue(parameters[name])
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(paramsDir, files[name]), []byte(value), 0644); err != nil {
+			return err
+		}
+	}
+	return writeEnv(filepath.Join(dest, "params.env"), parameters)
+}
+
+// writeTrigger writes the trigger of the execution, with its type, user,
+// parameters and artifacts, to trigger.json, so downstream jobs can tell
+// exactly what started the deployment
+func writeTrigger(dest string, execution []byte) error {
+	var trigger struct {
+		Trigger json.RawMessage `json:"trigger"`
+	}
+	if err := json.Unmarshal(execution, &trigger); err != nil {
+		return err
+	}
+	if len(trigger.Trigger) == 0 || string(trigger.Trigger) == "null" {
+		trigger.Trigger = json.RawMessage("{}")
+	}
+	return writeRawJSON(filepath.Join(dest, "trigger.json"), trigger.Trigger)
+}
+
+// writeEnv writes the values as shell exports tasks can source
+func writeEnv(path string, values map[string]interface{}) error {
+	var env strings.Builder
+	names := sortedNames(values)
+	variables := envNames(names)
+	for _, name := range names {
+		value, err := paramValue(values[name])
+		if err != nil {
+			return err
+		}
+		env.WriteString("export " + variables[name] + "=" + shellQuote(value) + "\n")
+	}
+	return ioutil.WriteFile(path, []byte(env.String()), 0644)
+}
+
+func sortedNames(values map[string]interface{}) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// paramValue returns string parameters as they are and the others as JSON
+func paramValue(value interface{}) (string, error) {
+	if value, ok := value.(string); ok {
+		return value, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// envNames maps each of the names to a distinct shell variable name, replacing
+// the characters variable names can't have with _. Names that end up the same
+// are told apart with a _2, _3... suffix in the order given, like fileNames.
+func envNames(names []string) map[string]string {
+	variables := make(map[string]string, len(names))
+	taken := make(map[string]bool, len(names))
+	for _, name := range names {
+		base := unsafeEnvChars.ReplaceAllString(name, "_")
+		if base == "" || (base[0] >= '0' && base[0] <= '9') {
+			base = "_" + base
+		}
+		variable := base
+		for n := 2; taken[variable]; n++ {
+			variable = fmt.Sprintf("%s_%d", base, n)
+		}
+		taken[variable] = true
+		variables[name] = variable
+	}
+	return variables
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// writeVariables writes the variables the Evaluate Variables stages of the
+// execution computed to variables.json, and as shell exports to variables.env.
+// When several stages evaluate the same variable the later one wins.
+func writeVariables(dest string, execution []byte) error {
+	var stages struct {
+		Stages []struct {
+			Type    string                 `json:"type"`
+			Outputs map[string]interface{} `json:"outputs"`
+		} `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+
+	variables := map[string]interface{}{}
+	for _, stage := range stages.Stages {
+		if stage.Type != "evaluateVariables" {
+			continue
+		}
+		for name, value := range stage.Outputs {
+			variables[name] = value
+		}
+	}
+
+	if err := writeJSON(filepath.Join(dest, "variables.json"), variables); err != nil {
+		return err
+	}
+	return writeEnv(filepath.Join(dest, "variables.env"), variables)
+}
@@ -0,0 +1,36 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+
+var _ = Describe("envNames", func() {
+	It("replaces the characters variable names can't have", func() {
+		Expect(envNames([]string{"version", "image-tag", "1st", ""})).To(Equal(map[string]string{
+			"version":   "version",
+			"image-tag": "image_tag",
+			"1st":       "_1st",
+			"":          "_",
+		}))
+	})
+
+	It("tells names that end up the same apart in their order", func() {
+		Expect(envNames([]string{"a-b", "a.b", "a_b", "a_b_2"})).To(Equal(map[string]string{
+			"a-b":   "a_b",
+			"a.b":   "a_b_2",
+			"a_b":   "a_b_3",
+			"a_b_2": "a_b_2_2",
+		}))
+	})
+})
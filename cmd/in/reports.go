@@ -0,0 +1,305 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reportExecution holds what the reports need of an execution. Custom stages
+// give their contexts any shape, so fields that don't have the expected one
+// are left empty instead of failing the get.
+type reportExecution struct {
+	Name        string
+	Application string
+	Status      string
+	StartTime   int64
+	EndTime     int64
+	Parameters  map[string]interface{}
+	Stages      []reportStage
+}
+
+type reportStage struct {
+	Name      string
+	Type      string
+	Status    string
+	StartTime int64
+	EndTime   int64
+	Details   map[string]interface{}
+}
+
+func parseReportExecution(execution []byte) (reportExecution, error) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(execution, &document); err != nil {
+		return reportExecution{}, err
+	}
+	report := reportExecution{
+		Name:        stringField(document, "name"),
+		Application: stringField(document, "application"),
+		Status:      stringField(document, "status"),
+		StartTime:   timeField(document, "startTime"),
+		EndTime:     timeField(document, "endTime"),
+	}
+	report.Parameters, _ = field(document, "trigger", "parameters").(map[string]interface{})
+	stages, _ := document["stages"].([]interface{})
+	for _, stage := range stages {
+		stage, ok := stage.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		details, _ := field(stage, "context", "exception", "details").(map[string]interface{})
+		report.Stages = append(report.Stages, reportStage{
+			Name:      stringField(stage, "name"),
+			Type:      stringField(stage, "type"),
+			Status:    stringField(stage, "status"),
+			StartTime: timeField(stage, "startTime"),
+			EndTime:   timeField(stage, "endTime"),
+			Details:   details,
+		})
+	}
+	return report, nil
+}
+
+// field looks up the value at the path of keys, nil when it isn't there
+func field(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func stringField(object map[string]interface{}, key string) string {
+	value, _ := object[key].(string)
+	return value
+}
+
+func timeField(object map[string]interface{}, key string) int64 {
+	value, _ := object[key].(float64)
+	return int64(value)
+}
+
+// duration is zero until the stage or execution has ended
+func duration(startTime, endTime int64) time.Duration {
+	if startTime == 0 || endTime < startTime {
+		return 0
+	}
+	return time.Duration(endTime-startTime) * time.Millisecond
+}
+
+func (s reportStage) failed() bool {
+	return s.Status == "TERMINAL" || s.Status == "FAILED_CONTINUE"
+}
+
+// failureMessage formats the errors of the stage, which are strings for the
+// built-in stages but may be objects for Kato tasks and custom stages
+func (s reportStage) failureMessage() string {
+	if errors, ok := s.Details["errors"].([]interface{}); ok && len(errors) > 0 {
+		messages := make([]string, 0, len(errors))
+		for _, e := range errors {
+			message, _ := paramValue(e)
+			messages = append(messages, message)
+		}
+		return strings.Join(messages, "\n")
+	}
+	if e, ok := s.Details["error"]; ok && e != nil && e != "" {
+		message, _ := paramValue(e)
+		return message
+	}
+	return "stage " + s.Status
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Details string `xml:",chardata"`
+}
+
+// writeJUnit reports each stage of the execution as a test case of junit.xml,
+// failed when the stage did and skipped when it never ran
+func writeJUnit(dest string, execution []byte) error {
+	report, err := parseReportExecution(execution)
+	if err != nil {
+		return err
+	}
+
+	suite := junitTestSuite{
+		Name:  report.Application + "." + report.Name,
+		Tests: len(report.Stages),
+		Time:  seconds(duration(report.StartTime, report.EndTime)),
+	}
+	for _, stage := range report.Stages {
+		testCase := junitTestCase{
+			Name:      stage.Name,
+			ClassName: suite.Name,
+			Time:      seconds(duration(stage.StartTime, stage.EndTime)),
+		}
+		switch {
+		case stage.failed():
+			message := stage.failureMessage()
+			testCase.Failure = &junitFailure{Message: strings.SplitN(message, "\n", 2)[0], Type: stage.Status, Details: message}
+			suite.Failures++
+		case stage.Status == "SKIPPED" || stage.Status == "CANCELED" || stage.Status == "NOT_STARTED":
+			testCase.Skipped = &struct{}{}
+			suite.Skipped++
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dest, "junit.xml"), append([]byte(xml.Header), data...), 0644)
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// writeSummary writes summary.md, a markdown summary of the execution and its
+// stages for notification tasks to post
+func writeSummary(dest string, execution []byte, executionID, executionURL string) error {
+	report, err := parseReportExecution(execution)
+	if err != nil {
+		return err
+	}
+
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "# %s/%s\n\n", report.Application, report.Name)
+	fmt.Fprintf(&summary, "**Status:** %s  \n", report.Status)
+	fmt.Fprintf(&summary, "**Duration:** %s  \n", formatDuration(duration(report.StartTime, report.EndTime)))
+	if executionURL != "" {
+		fmt.Fprintf(&summary, "**Execution:** [%s](%s)\n", executionID, executionURL)
+	} else {
+		fmt.Fprintf(&summary, "**Execution:** %s\n", executionID)
+	}
+
+	if len(report.Parameters) > 0 {
+		names := make([]string, 0, len(report.Parameters))
+		for name := range report.Parameters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		summary.WriteString("\n## Parameters\n\n| Name | Value |\n| --- | --- |\n")
+		for _, name := range names {
+			value, err := paramValue(report.Parameters[name])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&summary, "| %s | %s |\n", markdownCell(name), markdownCell(value))
+		}
+	}
+
+	summary.WriteString("\n## Stages\n\n| Stage | Type | Status | Duration |\n| --- | --- | --- | --- |\n")
+	for _, stage := range report.Stages {
+		fmt.Fprintf(&summary, "| %s | %s | %s | %s |\n", markdownCell(stage.Name), markdownCell(stage.Type), stage.Status, formatDuration(duration(stage.StartTime, stage.EndTime)))
+	}
+
+	return ioutil.WriteFile(filepath.Join(dest, "summary.md"), []byte(summary.String()), 0644)
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.String()
+}
+
+func markdownCell(value string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(value)
+}
+
+type timelineEntry struct {
+	Execution       string  `json:"execution"`
+	Pipeline        string  `json:"pipeline"`
+	Stage           string  `json:"stage"`
+	Type            string  `json:"type"`
+	Status          string  `json:"status"`
+	StartTime       string  `json:"startTime"`
+	EndTime         string  `json:"endTime"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// writeTimeline writes the start, end and duration of each stage of the
+// execution to timeline.csv and timeline.json, for deploy duration analysis.
+// Times are in RFC 3339, and empty for stages that haven't started or ended.
+func writeTimeline(dest string, execution []byte, executionID string) error {
+	report, err := parseReportExecution(execution)
+	if err != nil {
+		return err
+	}
+
+	entries := []timelineEntry{}
+	var timeline bytes.Buffer
+	w := csv.NewWriter(&timeline)
+	w.Write([]string{"execution", "pipeline", "stage", "type", "status", "start_time", "end_time", "duration_seconds"})
+	for _, stage := range report.Stages {
+		entry := timelineEntry{
+			Execution:       executionID,
+			Pipeline:        report.Name,
+			Stage:           stage.Name,
+			Type:            stage.Type,
+			Status:          stage.Status,
+			StartTime:       timestamp(stage.StartTime),
+			EndTime:         timestamp(stage.EndTime),
+			DurationSeconds: duration(stage.StartTime, stage.EndTime).Seconds(),
+		}
+		entries = append(entries, entry)
+		w.Write([]string{entry.Execution, entry.Pipeline, entry.Stage, entry.Type, entry.Status, entry.StartTime, entry.EndTime, seconds(duration(stage.StartTime, stage.EndTime))})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dest, "timeline.csv"), timeline.Bytes(), 0644); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dest, "timeline.json"), entries)
+}
+
+func timestamp(millis int64) string {
+	if millis == 0 {
+		return ""
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,256 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fileNames maps each of the free text names to a distinct file name, only
+// keeping its characters that are safe in file names. Names made of dots are
+// prefixed with a dash, and names that end up the same are told apart with a
+// -2, -3... suffix in the order given.
+func fileNames(names []string) map[string]string {
+	files := make(map[string]string, len(names))
+	taken := make(map[string]bool, len(names))
+	for _, name := range names {
+		base := unsafeFileChars.ReplaceAllString(name, "-")
+		if strings.Trim(base, ".") == "" {
+			base = "-" + base
+		}
+		file := base
+		for n := 2; taken[file]; n++ {
+			file = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken[file] = true
+		files[name] = file
+	}
+	return files
+}
+
+// writeStages writes each stage of the execution to stages/<index>-<name>.json,
+// so tasks can read the result of one stage without parsing the whole execution
+func writeStages(dest string, execution []byte) error {
+	var stages struct {
+		Stages []json.RawMessage `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+
+	stagesDir := filepath.Join(dest, "stages")
+	if err := os.MkdirAll(stagesDir, 0755); err != nil {
+		return err
+	}
+	for i, stage := range stages.Stages {
+		var named struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(stage, &named); err != nil {
+			return err
+		}
+		err := writeExecutionJSON(filepath.Join(stagesDir, stageFileName(i, named.Name)), stage)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageFileName only keeps the characters of the free text stage name that are safe in file names
+func stageFileName(index int, name string) string {
+	return fmt.Sprintf("%d-%s.json", index, unsafeFileChars.ReplaceAllString(name, "-"))
+}
+
+// writeOutputs writes the outputs of each stage that has some to
+// outputs/<index>-<name>.json, and all of them merged to outputs.json. As in
+// the pipeline context, the outputs of later stages win.
+func writeOutputs(dest string, execution []byte) error {
+	var stages struct {
+		Stages []struct {
+			Name    string                 `json:"name"`
+			Outputs map[string]interface{} `json:"outputs"`
+		} `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+
+	outputsDir := filepath.Join(dest, "outputs")
+	if err := os.MkdirAll(outputsDir, 0755); err != nil {
+		return err
+	}
+	merged := map[string]interface{}{}
+	for i, stage := range stages.Stages {
+		if len(stage.Outputs) == 0 {
+			continue
+		}
+		if err := writeJSON(filepath.Join(outputsDir, stageFileName(i, stage.Name)), stage.Outputs); err != nil {
+			return err
+		}
+		for key, value := range stage.Outputs {
+			merged[key] = value
+		}
+	}
+	return writeJSON(filepath.Join(dest, "outputs.json"), merged)
+}
+
+// jsonFormat is how the JSON files are written: as they come from Gate or
+// json.Marshal when empty, otherwise re-encoded with sorted keys, either
+// "indent"ed for humans or "compact" for machines
+var jsonFormat string
+
+func setJSONFormat(format string) error {
+	if format != "" && format != "indent" && format != "compact" {
+		return fmt.Errorf("invalid json_format: %s, must be indent or compact", format)
+	}
+	jsonFormat = format
+	return nil
+}
+
+func writeJSON(path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return writeRawJSON(path, data)
+}
+
+// writeRawJSON writes a JSON document in the configured json_format
+func writeRawJSON(path string, data []byte) error {
+	data, err := formatJSON(data)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// compression is either "gzip" or empty, to write the execution documents
+// uncompressed
+var compression string
+
+func setCompression(format string) error {
+	if format != "" && format != "gzip" {
+		return fmt.Errorf("invalid compress: %s, must be gzip", format)
+	}
+	compression = format
+	return nil
+}
+
+// writeExecutionJSON writes the documents making up the execution, which
+// may be hundreds of megabytes, to path.gz when they are compressed
+func writeExecutionJSON(path string, data []byte) error {
+	data, err := formatJSON(data)
+	if err != nil {
+		return err
+	}
+	if compression == "" {
+		return ioutil.WriteFile(path, data, 0644)
+	}
+
+	file, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := gzip.NewWriter(file)
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func formatJSON(data []byte) ([]byte, error) {
+	if jsonFormat == "" {
+		return data, nil
+	}
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	//maps are encoded with sorted keys, so diffs between executions only show what changed
+	if jsonFormat == "indent" {
+		return json.MarshalIndent(document, "", "  ")
+	}
+	return json.Marshal(document)
+}
+
+type webhookExchange struct {
+	Stage      string      `json:"stage"`
+	Method     string      `json:"method,omitempty"`
+	URL        string      `json:"url"`
+	Payload    interface{} `json:"payload,omitempty"`
+	StatusCode interface{} `json:"statusCode,omitempty"`
+	Response   interface{} `json:"response,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// writeWebhooks writes the request and response Orca recorded for each Webhook
+// stage of the execution to webhooks/<index>-<name>.json, so the IDs returned
+// by change management systems can be read downstream
+func writeWebhooks(dest string, execution []byte) error {
+	var stages struct {
+		Stages []struct {
+			Name    string `json:"name"`
+			Type    string `json:"type"`
+			Context struct {
+				Method  string      `json:"method"`
+				URL     string      `json:"url"`
+				Payload interface{} `json:"payload"`
+				Webhook struct {
+					StatusCode interface{} `json:"statusCode"`
+					Body       interface{} `json:"body"`
+					Error      string      `json:"error"`
+				} `json:"webhook"`
+			} `json:"context"`
+		} `json:"stages"`
+	}
+	if err := json.Unmarshal(execution, &stages); err != nil {
+		return err
+	}
+
+	webhooksDir := filepath.Join(dest, "webhooks")
+	if err := os.MkdirAll(webhooksDir, 0755); err != nil {
+		return err
+	}
+	for i, stage := range stages.Stages {
+		if stage.Type != "webhook" {
+			continue
+		}
+		exchange := webhookExchange{
+			Stage:      stage.Name,
+			Method:     stage.Context.Method,
+			URL:        stage.Context.URL,
+			Payload:    stage.Context.Payload,
+			StatusCode: stage.Context.Webhook.StatusCode,
+			Response:   stage.Context.Webhook.Body,
+			Error:      stage.Context.Webhook.Error,
+		}
+		if err := writeJSON(filepath.Join(webhooksDir, stageFileName(i, stage.Name)), exchange); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("fileNames", func() {
+	It("replaces the characters that aren't safe in file names", func() {
+		Expect(fileNames([]string{"version", "image tag", "../etc/passwd"})).To(Equal(map[string]string{
+			"version":       "version",
+			"image tag":     "image-tag",
+			"../etc/passwd": "..-etc-passwd",
+		}))
+	})
+
+	It("rewrites names made of dots", func() {
+		Expect(fileNames([]string{".", "..", ""})).To(Equal(map[string]string{
+			".":  "-.",
+			"..": "-..",
+			"":   "-",
+		}))
+	})
+
+	It("tells names that end up the same apart in their order", func() {
+		Expect(fileNames([]string{"a b", "a-b", "a/b", "a-b-2"})).To(Equal(map[string]string{
+			"a b":   "a-b",
+			"a-b":   "a-b-2",
+			"a/b":   "a-b-3",
+			"a-b-2": "a-b-2-2",
+		}))
+	})
+})
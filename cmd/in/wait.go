@@ -0,0 +1,77 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+const defaultWaitInterval = 30 * time.Second
+const defaultWaitTimeout = time.Hour
+
+// waitForCompletion polls the execution until it ended, and returns it as it
+// ended. Gate being briefly unavailable doesn't stop the wait.
+func waitForCompletion(ctx context.Context, spinClient spinnaker.SpinClient, source concourse.Source, params concourse.InParams, executionID string) ([]byte, error) {
+	interval, err := durationDefault(source.StatusCheckInterval, defaultWaitInterval)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := durationDefault(params.WaitTimeout, defaultWaitTimeout)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.After(timeout)
+
+	concourse.Sayf("Waiting for the execution to complete, Poll Interval: %v, Timeout: %v\n", interval, timeout)
+	for {
+		execution, err := spinClient.GetPipelineExecutionRaw(ctx, executionID)
+		var apiErr *spinnaker.APIError
+		if err != nil && !(errors.As(err, &apiErr) && apiErr.Temporary()) {
+			return nil, err
+		}
+		if err == nil {
+			var status struct {
+				Status string `json:"status"`
+			}
+			if err := json.Unmarshal(execution, &status); err != nil {
+				return nil, err
+			}
+			if !spinnaker.ActiveStatus(status.Status) {
+				concourse.Sayf("\n")
+				return execution, nil
+			}
+		}
+		concourse.Sayf(".")
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			concourse.Sayf("\n")
+			return nil, fmt.Errorf("aborted waiting for the execution to complete")
+		case <-deadline:
+			concourse.Sayf("\n")
+			return nil, fmt.Errorf("timed out waiting for the execution to complete")
+		}
+	}
+}
+
+func durationDefault(duration string, defaultDuration time.Duration) (time.Duration, error) {
+	if duration == "" {
+		return defaultDuration, nil
+	}
+	return time.ParseDuration(duration)
+}
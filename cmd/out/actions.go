@@ -0,0 +1,148 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/metrics"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+	"github.com/pivotal-cf/spinnaker-resource/tracing"
+)
+
+const defaultCancelReason = "Canceled from Concourse"
+
+type executionActionFunc func(ctx context.Context, executionID string) (string, error)
+
+// executionAction returns the action to run on an existing execution instead
+// of triggering the pipeline, if the params ask for one
+func executionAction(params concourse.OutParams) (string, executionActionFunc, error) {
+	if params.Restart != nil {
+		if params.Action != "" {
+			return "", nil, fmt.Errorf("restart and action can't both be set, use one put step for each")
+		}
+		return params.Restart.ExecutionID, restartExecution, nil
+	}
+	switch params.Action {
+	case "":
+		return "", nil, nil
+	case "pause":
+		return params.ExecutionID, pauseExecution, nil
+	case "resume":
+		return params.ExecutionID, resumeExecution, nil
+	case "cancel":
+		reason := params.Reason
+		if reason == "" {
+			reason = defaultCancelReason
+		}
+		return params.ExecutionID, func(ctx context.Context, executionID string) (string, error) {
+			return abortExecution(ctx, executionID, reason)
+		}, nil
+	}
+	return "", nil, fmt.Errorf("invalid action: %s, must be pause, resume or cancel", params.Action)
+}
+
+// runExecutionAction runs the action on the execution and emits it as the
+// version, which only needs an application to be configured
+func runExecutionAction(request concourse.OutRequest, executionID string, action executionActionFunc) {
+	if executionID == "" {
+		concourse.Fatal("put step failed", errors.New("execution_id must be configured to act on an execution"))
+	}
+
+	transport, err := spinnaker.NewTransport(request.Source)
+	if err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	metrics.Setup(request.Source, "out", transport)
+	tracing.Setup(request.Source, "out", transport)
+
+	ctx, cancel := concourse.SignalContext()
+	defer cancel()
+
+	spinClient, err = spinnaker.NewReadClient(ctx, request.Source)
+	if err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	request.Source = spinClient.Source()
+
+	done, err := action(ctx, executionID)
+	if err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	concourse.Sayf("%s\n", done)
+
+	execution, err := spinClient.GetPipelineExecution(ctx, executionID)
+	if err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	version, err := executionVersion(request.Source, execution)
+	if err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	output := concourse.OutResponse{Version: version}
+	if executionURL := request.Source.ExecutionURL(request.Source.SpinnakerApplication, executionID); executionURL != "" {
+		concourse.Sayf("Execution: %s\n", executionURL)
+		output.Metadata = append(output.Metadata, concourse.MetadataPair{Name: "URL", Value: executionURL})
+	}
+	concourse.WriteResponse(output)
+}
+
+// restartExecution resumes a TERMINAL execution by restarting its first failed stage
+func restartExecution(ctx context.Context, executionID string) (string, error) {
+	raw, err := spinClient.GetPipelineExecutionRaw(ctx, executionID)
+	if err != nil {
+		return "", err
+	}
+	var execution spinnaker.PipelineExecution
+	if err := json.Unmarshal(raw, &execution); err != nil {
+		return "", err
+	}
+	if execution.Status != "TERMINAL" {
+		return "", fmt.Errorf("execution %s is %s, only TERMINAL executions can be restarted", executionID, execution.Status)
+	}
+	for _, stage := range execution.Stages {
+		if stage.Status == "TERMINAL" {
+			if err := spinClient.RestartStage(ctx, executionID, stage.ID); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Restarted execution %s from stage %s", executionID, stage.Name), nil
+		}
+	}
+	return "", fmt.Errorf("execution %s has no failed stage to restart", executionID)
+}
+
+// pauseExecution pauses a running execution, e.g. for a maintenance window
+func pauseExecution(ctx context.Context, executionID string) (string, error) {
+	if err := spinClient.PausePipelineExecution(ctx, executionID); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Paused execution %s", executionID), nil
+}
+
+// resumeExecution resumes an execution paused by pauseExecution or from Deck
+func resumeExecution(ctx context.Context, executionID string) (string, error) {
+	if err := spinClient.ResumePipelineExecution(ctx, executionID); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Resumed execution %s", executionID), nil
+}
+
+// abortExecution cancels an execution on behalf of an operator, recording the
+// reason in it
+func abortExecution(ctx context.Context, executionID, reason string) (string, error) {
+	if err := spinClient.CancelPipelineExecution(ctx, executionID, reason); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Canceled execution %s: %s", executionID, reason), nil
+}
@@ -0,0 +1,178 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+// inputArtifact converts an input of the put step to the Spinnaker artifact
+// it holds, from the files the usual resources of its type write
+func inputArtifact(sourcesDir string, input concourse.InputArtifact) (map[string]interface{}, error) {
+	if input.Type == "" {
+		return nil, errors.New("artifacts need a type")
+	}
+	dir := filepath.Join(sourcesDir, input.Input)
+
+	var name, version, reference string
+	var err error
+	if input.Type == "embedded/base64" && input.File != "" {
+		//rendered manifests are handed straight to Deploy (Manifest) stages this way
+		name, reference, err = embeddedArtifact(filepath.Join(dir, input.File))
+		if err != nil {
+			return nil, err
+		}
+	} else if input.Input != "" {
+		switch input.Type {
+		case "docker/image":
+			name, version, reference, err = dockerImageArtifact(dir)
+		case "s3/object":
+			name, version, reference, err = s3ObjectArtifact(dir)
+		case "git/repo":
+			version, reference, err = gitRepoArtifact(dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//what's configured explicitly wins over what's read from the input
+	if input.Name != "" {
+		name = input.Name
+	}
+	if input.Version != "" {
+		version = input.Version
+	}
+	if input.Reference != "" {
+		reference = input.Reference
+	}
+	if reference == "" {
+		return nil, fmt.Errorf("no reference for the %s artifact of input %s", input.Type, input.Input)
+	}
+
+	artifact := map[string]interface{}{
+		"type":      input.Type,
+		"reference": reference,
+	}
+	if name != "" {
+		artifact["name"] = name
+	}
+	if version != "" {
+		artifact["version"] = version
+	}
+	if input.ArtifactAccount != "" {
+		artifact["artifactAccount"] = input.ArtifactAccount
+	}
+	return artifact, nil
+}
+
+// embeddedArtifact reads a file to embed in the artifact, named after the file
+func embeddedArtifact(path string) (name, reference string, err error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Base(path), base64.StdEncoding.EncodeToString(contents), nil
+}
+
+// dockerImageArtifact reads the repository, digest and tag files the
+// registry-image and docker-image resources write
+func dockerImageArtifact(dir string) (name, version, reference string, err error) {
+	name, err = readInputFile(dir, "repository")
+	if err != nil {
+		return "", "", "", err
+	}
+	if digest, err := readOptionalInputFile(dir, "digest"); err != nil || digest != "" {
+		return name, digest, name + "@" + digest, err
+	}
+	tag, err := readOptionalInputFile(dir, "tag")
+	if err != nil || tag == "" {
+		return name, "", name, err
+	}
+	return name, tag, name + ":" + tag, nil
+}
+
+// s3ObjectArtifact reads the s3_uri (or url) and version files the s3 resource writes
+func s3ObjectArtifact(dir string) (name, version, reference string, err error) {
+	reference, err = readOptionalInputFile(dir, "s3_uri")
+	if err == nil && reference == "" {
+		reference, err = readInputFile(dir, "url")
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	version, err = readOptionalInputFile(dir, "version")
+	return reference, version, reference, err
+}
+
+// gitRepoArtifact reads the commit in the .git/ref file the git resource
+// writes, and the url of the origin remote it cloned from
+func gitRepoArtifact(dir string) (version, reference string, err error) {
+	version, err = readInputFile(dir, filepath.Join(".git", "ref"))
+	if err != nil {
+		return "", "", err
+	}
+	config, err := readOptionalInputFile(dir, filepath.Join(".git", "config"))
+	if err != nil {
+		return "", "", err
+	}
+	return version, originURL(config), nil
+}
+
+// originURL finds the url of the origin remote in a git config file, without
+// the credentials it may embed
+func originURL(config string) string {
+	inOrigin := false
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inOrigin = strings.Join(strings.Fields(line), " ") == `[remote "origin"]`
+			continue
+		}
+		key, value := line, ""
+		if i := strings.Index(line, "="); i >= 0 {
+			key, value = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		}
+		if !inOrigin || !strings.EqualFold(key, "url") {
+			continue
+		}
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			u.User = nil
+			return u.String()
+		}
+		return value
+	}
+	return ""
+}
+
+func readInputFile(dir, name string) (string, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+func readOptionalInputFile(dir, name string) (string, error) {
+	value, err := readInputFile(dir, name)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return value, err
+}
@@ -0,0 +1,71 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+// validateManualJudgment checks the manual_judgment param before the pipeline is triggered
+func validateManualJudgment(action string) error {
+	switch action {
+	case "", "wait", "fail", "continue", "stop":
+		return nil
+	}
+	return fmt.Errorf("invalid manual_judgment: %s, must be wait, fail, continue or stop", action)
+}
+
+// handleManualJudgments applies the manual_judgment param to the Manual
+// Judgment stages the execution is waiting at: it keeps waiting for a person
+// to judge them, fails the step, or judges them itself
+func handleManualJudgments(ctx context.Context, pipelineExecutionID string, execution map[string]interface{}, wait statusWait) error {
+	if wait.judgment == "" || wait.judgment == "wait" {
+		return nil
+	}
+
+	stages, _ := execution["stages"].([]interface{})
+	for _, stage := range stages {
+		stage, _ := stage.(map[string]interface{})
+		stageType, _ := stage["type"].(string)
+		status, _ := stage["status"].(string)
+		if stageType != "manualJudgment" || status != "RUNNING" {
+			continue
+		}
+		//judged stages keep running until Orca picks the judgment up
+		stageContext, _ := stage["context"].(map[string]interface{})
+		if judgmentStatus, _ := stageContext["judgmentStatus"].(string); judgmentStatus != "" {
+			continue
+		}
+
+		name, _ := stage["name"].(string)
+		if wait.judgment == "fail" {
+			concourse.Sayf("\n")
+			return fmt.Errorf("Pipeline execution is waiting for manual judgment at stage %s", name)
+		}
+
+		judgment, err := json.Marshal(map[string]string{
+			"judgmentStatus": wait.judgment,
+			"judgmentInput":  wait.judgmentInput,
+		})
+		if err != nil {
+			return err
+		}
+		stageID, _ := stage["id"].(string)
+		if err := spinClient.SubmitManualJudgment(ctx, pipelineExecutionID, stageID, judgment); err != nil {
+			return err
+		}
+		concourse.Sayf("\nJudged stage %s: %s\n", name, wait.judgment)
+	}
+	return nil
+}
@@ -1,22 +1,30 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/mitchellh/colorstring"
 	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/metrics"
 	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+	"github.com/pivotal-cf/spinnaker-resource/tracing"
 )
 
 var spinClient spinnaker.SpinClient
 
 const defaultPollingInterval = "30s"
 const defaultPollingTimeout = "31s"
+const defaultCompletionTimeout = "1h"
+const cancelTimeout = 5 * time.Second
 
 var triggerParamsBase = map[string]interface{}{"type": "concourse-resource"}
 
@@ -31,72 +39,278 @@ func main() {
 
 	sourcesDir := os.Args[1]
 
-	spinClient, err = spinnaker.NewClient(request.Source)
+	executionID, action, err := executionAction(request.Params)
 	if err != nil {
 		concourse.Fatal("put step failed", err)
 	}
+	if action != nil {
+		runExecutionAction(request, executionID, action)
+		return
+	}
+
+	//the get after the put runs with the source as configured
+	watched := request.Source
+	//one resource can trigger several pipelines of the application from different jobs
+	if request.Params.Pipeline != "" {
+		request.Source.SpinnakerPipeline = request.Params.Pipeline
+		request.Source.SpinnakerPipelineID = ""
+	}
+	if request.Params.PipelineID != "" {
+		request.Source.SpinnakerPipeline = ""
+		request.Source.SpinnakerPipelineID = request.Params.PipelineID
+	}
+
+	if request.Source.SpinnakerApplication == "" || (request.Source.SpinnakerPipeline == "" && request.Source.SpinnakerPipelineID == "") {
+		concourse.Fatal("put step failed", errors.New("spinnaker_application and spinnaker_pipeline or spinnaker_pipeline_id must be configured to trigger a pipeline"))
+	}
+
+	if request.Params.RunAsUser != "" {
+		request.Source.RunAsUser = request.Params.RunAsUser
+	}
+
+	if err = validateManualJudgment(request.Params.ManualJudgment); err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+
+	transport, err := spinnaker.NewTransport(request.Source)
+	if err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	metrics.Setup(request.Source, "out", transport)
+	tracing.Setup(request.Source, "out", transport)
+
+	ctx, cancel := concourse.SignalContext()
+	defer cancel()
 
-	pipelineExecutionID, err := invokePipeline(sourcesDir, request)
+	spinClient, err = spinnaker.NewClient(ctx, request.Source)
+	if err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	request.Source = spinClient.Source()
+
+	eventID, err := triggerEventID(watched, request.Params)
+	if err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	postBody, err := triggerBody(sourcesDir, request, eventID)
 	if err != nil {
 		concourse.Fatal("put step failed", err)
 	}
-	if len(request.Source.Statuses) > 0 {
-		err = pollSpinnakerForStatus(request, pipelineExecutionID)
+	if request.Params.DryRun {
+		writeDryRunResponse(request, postBody)
+		return
+	}
+
+	var pipelineExecutionID string
+	if request.Params.Idempotent || request.Params.EventID != "" {
+		pipelineExecutionID, err = existingExecution(ctx, eventID)
 		if err != nil {
 			concourse.Fatal("put step failed", err)
 		}
-		writeSuccessfulResponse(pipelineExecutionID)
 	}
-	writeSuccessfulResponse(pipelineExecutionID)
+	if pipelineExecutionID == "" {
+		pipelineExecutionID, err = invokePipeline(ctx, request, postBody)
+		if err != nil {
+			concourse.Fatal("put step failed", err)
+		}
+	}
+	var execution map[string]interface{}
+	if waitsForStatus(request) {
+		wait := statusWait{statuses: request.Source.Statuses, description: "configured status(es)", defaultTimeout: defaultPollingTimeout}
+		//deploy pipelines take much longer than the statuses usually waited for,
+		//and failure statuses or judgments without statuses to wait for last until it completes
+		if request.Params.WaitForCompletion || len(wait.statuses) == 0 && len(request.Params.SuccessStatuses) == 0 {
+			wait = statusWait{statuses: []string{"SUCCEEDED"}, description: "the execution to complete", defaultTimeout: defaultCompletionTimeout}
+		}
+		if len(request.Params.SuccessStatuses) > 0 {
+			wait.statuses = request.Params.SuccessStatuses
+		}
+		wait.failures = request.Params.FailureStatuses
+		wait.judgment = request.Params.ManualJudgment
+		wait.judgmentInput = request.Params.JudgmentInput
+		execution, err = pollSpinnakerForStatus(ctx, request, pipelineExecutionID, wait)
+	} else {
+		execution, err = spinClient.GetPipelineExecution(ctx, pipelineExecutionID)
+	}
+	if err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	version, err := executionVersion(watched, execution)
+	if err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	writeSuccessfulResponse(version, request.Source.ExecutionURL(request.Source.SpinnakerApplication, pipelineExecutionID))
+}
+
+// waitsForStatus tells whether the put step polls the execution it triggered,
+// which the params only used while polling turn on too
+func waitsForStatus(request concourse.OutRequest) bool {
+	return len(request.Source.Statuses) > 0 || request.Params.WaitForCompletion ||
+		len(request.Params.SuccessStatuses) > 0 || len(request.Params.FailureStatuses) > 0 || request.Params.ManualJudgment != ""
+}
+
+// executionVersion returns the version check emits for the execution, so the
+// execution doesn't appear twice in the history of the resource. Executions
+// of pipelines and applications the source doesn't watch, e.g. triggered with
+// the pipeline param, tell them in the version for the get after the put.
+func executionVersion(source concourse.Source, execution map[string]interface{}) (concourse.Version, error) {
+	raw, err := json.Marshal(execution)
+	if err != nil {
+		return concourse.Version{}, err
+	}
+	var pipelineExecution spinnaker.PipelineExecution
+	if err := json.Unmarshal(raw, &pipelineExecution); err != nil {
+		return concourse.Version{}, err
+	}
+	version := spinnaker.VersionFor(pipelineExecution, source)
+
+	watched, err := source.WatchesPipeline(pipelineExecution.Name)
+	if err != nil {
+		return concourse.Version{}, err
+	}
+	if !watched {
+		version.Pipeline = pipelineExecution.Name
+	}
+	watched, err = source.WatchesApplication(pipelineExecution.Application)
+	if err != nil {
+		return concourse.Version{}, err
+	}
+	if !watched {
+		version.Application = pipelineExecution.Application
+	}
+	return version, nil
+}
+
+// triggerEventID returns the eventId to tag the trigger with: the event_id
+// param, tagged for triggered_by_me_only, one shared by the retries of the
+// build for idempotent triggers, or a random one for triggered_by_me_only.
+// They are tagged for the source as configured, which check filters with.
+func triggerEventID(watched concourse.Source, params concourse.OutParams) (string, error) {
+	if params.EventID != "" && watched.TriggeredByMeOnly {
+		return spinnaker.TaggedEventID(watched, params.EventID), nil
+	}
+	if params.EventID != "" {
+		return params.EventID, nil
+	}
+	if params.Idempotent {
+		buildID := os.Getenv("BUILD_ID")
+		if buildID == "" {
+			return "", errors.New("idempotent triggers need the BUILD_ID of the build")
+		}
+		return spinnaker.BuildEventID(watched, os.Getenv("ATC_EXTERNAL_URL")+"/"+buildID), nil
+	}
+	if watched.TriggeredByMeOnly {
+		return spinnaker.NewEventID(watched)
+	}
+	return "", nil
+}
+
+// existingExecution returns the ID of the execution a previous attempt of the
+// step triggered with the eventId, or an empty one when there is none
+func existingExecution(ctx context.Context, eventID string) (string, error) {
+	execution, err := spinClient.GetPipelineExecutionByEventID(ctx, eventID)
+	if errors.Is(err, spinnaker.ErrPipelineExecutionNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	concourse.Sayf("Found execution %s triggered with eventId %s, not executing the pipeline again\n", execution.ID, eventID)
+	return execution.ID, nil
 }
 
-func invokePipeline(sourcesDir string, request concourse.OutRequest) (string, error) {
+// triggerBody builds the trigger the pipeline is executed with from the params
+func triggerBody(sourcesDir string, request concourse.OutRequest, eventID string) ([]byte, error) {
 	TriggerParamsMap := triggerParamsBase
 
-	triggerParams := map[string]string{}
+	triggerParams := map[string]interface{}{}
+	if request.Params.BuildMetadata {
+		for _, name := range buildMetadata {
+			if value := os.Getenv(name); value != "" {
+				triggerParams[name] = value
+			}
+		}
+	}
 	if len(request.Params.TriggerParams) > 0 {
 		for key, value := range request.Params.TriggerParams {
-			triggerParams[key] = os.ExpandEnv(value)
+			//numbers and booleans from the pipeline YAML are sent as they are
+			if stringValue, ok := value.(string); ok {
+				value = os.ExpandEnv(stringValue)
+			}
+			value, err := fileValue(sourcesDir, value)
+			if err != nil {
+				return nil, err
+			}
+			triggerParams[key] = value
 		}
 	}
-	if len(request.Params.TriggerParamsJSONFilePath) > 0 {
-		localPath := filepath.Join(sourcesDir, request.Params.TriggerParamsJSONFilePath)
-		dynamicTriggerParams, err := ioutil.ReadFile(localPath)
-		if err != nil {
-			return "", err
+	paramsFile := request.Params.TriggerParamsFile
+	//trigger_params_file reads the same JSON files, and YAML ones too
+	if request.Params.TriggerParamsJSONFilePath != "" {
+		if paramsFile != "" {
+			return nil, errors.New("trigger_params_json_file and trigger_params_file can't both be set, trigger_params_json_file is deprecated in favor of trigger_params_file")
 		}
-		err = json.Unmarshal(dynamicTriggerParams, &triggerParams)
+		concourse.Sayf(colorstring.Color("[yellow]WARNING: %s\n"), "trigger_params_json_file is deprecated, use trigger_params_file instead")
+		paramsFile = request.Params.TriggerParamsJSONFilePath
+	}
+	if paramsFile != "" {
+		fileParams, err := readParamsFile(filepath.Join(sourcesDir, paramsFile))
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		for key, value := range fileParams {
+			triggerParams[key] = value
 		}
 	}
 	if len(triggerParams) > 0 {
 		TriggerParamsMap["parameters"] = triggerParams
 	}
+	if len(request.Params.Notifications) > 0 {
+		TriggerParamsMap["notifications"] = request.Params.Notifications
+	}
+	//Orca runs the execution as this service account, which pipelines with restricted accounts need
+	if request.Params.ServiceAccount != "" {
+		TriggerParamsMap["runAsUser"] = request.Params.ServiceAccount
+	}
+	if eventID != "" {
+		TriggerParamsMap["eventId"] = eventID
+	}
 	if len(request.Params.Artifacts) > 0 {
 		localPath := filepath.Join(sourcesDir, request.Params.Artifacts)
 		artifacts, err := ioutil.ReadFile(localPath)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		var JSONArtifacts interface{}
+		var JSONArtifacts []interface{}
 		err = json.Unmarshal(artifacts, &JSONArtifacts)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		TriggerParamsMap["artifacts"] = JSONArtifacts
 	}
-	postBody, err := json.Marshal(TriggerParamsMap)
-	if err != nil {
-		return "", err
+	if len(request.Params.InputArtifacts) > 0 {
+		JSONArtifacts, _ := TriggerParamsMap["artifacts"].([]interface{})
+		for _, input := range request.Params.InputArtifacts {
+			artifact, err := inputArtifact(sourcesDir, input)
+			if err != nil {
+				return nil, err
+			}
+			JSONArtifacts = append(JSONArtifacts, artifact)
+		}
+		TriggerParamsMap["artifacts"] = JSONArtifacts
 	}
+	return json.Marshal(TriggerParamsMap)
+}
 
+func invokePipeline(ctx context.Context, request concourse.OutRequest, postBody []byte) (string, error) {
 	concourse.Sayf("Executing pipeline: '%s/%s'\n", request.Source.SpinnakerApplication, request.Source.SpinnakerPipeline)
 
-	pipelineExecution, err := spinClient.InvokePipelineExecution(postBody)
+	pipelineExecution, err := spinClient.InvokePipelineExecution(ctx, postBody)
 	if err != nil {
 		return "", err
 	}
+	metrics.IncTriggers()
+	tracing.SetAttribute("spinnaker.execution.id", pipelineExecution.ID)
 	return pipelineExecution.ID, nil
 }
 
@@ -107,75 +321,171 @@ func parseDurationDefault(stringDuration, defaultDuration string) (time.Duration
 	return time.ParseDuration(stringDuration)
 }
 
-func pollSpinnakerForStatus(request concourse.OutRequest, pipelineExecutionID string) error {
+// statusWait describes what the put step waits for the execution to reach
+type statusWait struct {
+	statuses       []string
+	failures       []string
+	judgment       string
+	judgmentInput  string
+	description    string
+	defaultTimeout string
+}
+
+func pollSpinnakerForStatus(ctx context.Context, request concourse.OutRequest, pipelineExecutionID string, wait statusWait) (map[string]interface{}, error) {
 
-	interval, err := parseDurationDefault(request.Source.StatusCheckInterval, defaultPollingInterval)
+	interval, err := parseDurationDefault(firstSet(request.Params.PollInterval, request.Source.StatusCheckInterval), defaultPollingInterval)
 	if err != nil {
 		concourse.Fatal("put step failed", err)
 	}
-	timeout, err := parseDurationDefault(request.Source.StatusCheckTimeout, defaultPollingTimeout)
+	timeout, err := parseDurationDefault(firstSet(request.Params.Timeout, request.Source.StatusCheckTimeout), wait.defaultTimeout)
 	if err != nil {
 		concourse.Fatal("put step failed", err)
 	}
 
 	concourse.Sayf("Poll Interval: %v, Timeout: %v\n", interval, timeout)
 
-	statusReached, err := pollForStatus(pipelineExecutionID, request.Source.Statuses)
+	execution, statusReached, err := pollForStatus(ctx, pipelineExecutionID, wait)
+	if ctx.Err() != nil {
+		return nil, abortWait(request, pipelineExecutionID, wait)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if statusReached {
-		return nil
+		return execution, nil
 	}
 
 	pollTicker := time.NewTicker(interval)
+	defer pollTicker.Stop()
 	timeoutTicker := time.NewTicker(timeout)
+	defer timeoutTicker.Stop()
 
 	for {
 		select {
 
 		case <-pollTicker.C:
-			statusReached, err := pollForStatus(pipelineExecutionID, request.Source.Statuses)
+			execution, statusReached, err := pollForStatus(ctx, pipelineExecutionID, wait)
+			//aborts mostly land while a poll is in flight, which fails with the context
+			if ctx.Err() != nil {
+				return nil, abortWait(request, pipelineExecutionID, wait)
+			}
+			//the pipeline keeps running while Gate is briefly unavailable, so keep waiting
+			var apiErr *spinnaker.APIError
+			if errors.As(err, &apiErr) && apiErr.Temporary() {
+				concourse.Sayf("!")
+				continue
+			}
 			if err != nil {
-				return err
+				return nil, err
 			}
 			if statusReached {
-				return nil
+				return execution, nil
 			}
+		case <-ctx.Done():
+			return nil, abortWait(request, pipelineExecutionID, wait)
 		case <-timeoutTicker.C:
 			concourse.Sayf("\n")
-			return fmt.Errorf("timed out waiting for configured status(es)")
+			return nil, fmt.Errorf("timed out waiting for %s after %v, execution %s is still running", wait.description, timeout, runningExecution(request.Source, pipelineExecutionID))
 		}
 	}
 
 }
 
-func pollForStatus(pipelineExecutionID string, statuses []string) (bool, error) {
+// abortWait stops waiting for the execution of an aborted build, canceling it
+// with cancel_on_abort
+func abortWait(request concourse.OutRequest, pipelineExecutionID string, wait statusWait) error {
+	concourse.Sayf("\n")
+	if request.Params.CancelOnAbort {
+		cancelExecution(pipelineExecutionID)
+	}
+	return fmt.Errorf("aborted waiting for %s", wait.description)
+}
+
+// cancelExecution cancels the execution of an aborted build, so the
+// deployment doesn't go on unattended. The context of the build is done by
+// then, so the request gets a short one of its own.
+func cancelExecution(pipelineExecutionID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+	if err := spinClient.CancelPipelineExecution(ctx, pipelineExecutionID, "Concourse build aborted"); err != nil {
+		concourse.Sayf("Failed to cancel execution %s: %s\n", pipelineExecutionID, err)
+		return
+	}
+	concourse.Sayf("Canceled execution %s\n", pipelineExecutionID)
+}
+
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// runningExecution links to the execution when spinnaker_ui is set, so the
+// timeout error tells where to follow it
+func runningExecution(source concourse.Source, pipelineExecutionID string) string {
+	if executionURL := source.ExecutionURL(source.SpinnakerApplication, pipelineExecutionID); executionURL != "" {
+		return executionURL
+	}
+	return pipelineExecutionID
+}
+
+func pollForStatus(ctx context.Context, pipelineExecutionID string, wait statusWait) (map[string]interface{}, bool, error) {
 	var statusReached bool
-	rawPipeline, err := spinClient.GetPipelineExecution(pipelineExecutionID)
+	metrics.IncPollIterations()
+	rawPipeline, err := spinClient.GetPipelineExecution(ctx, pipelineExecutionID)
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
-	statusReached = checkStatus(rawPipeline["status"].(string), statuses)
+	statusReached = checkStatus(rawPipeline["status"].(string), wait.statuses)
 
 	//Intermediate statuses
 	if statusReached {
 		concourse.Sayf("\n")
-		return true, nil
+		return rawPipeline, true, nil
 	}
 	status := rawPipeline["status"].(string)
-	if status != "RUNNING" && status != "NOT_STARTED" && status != "BUFFERED" {
+	if len(wait.failures) > 0 && checkStatus(status, wait.failures) {
+		concourse.Sayf("\n")
+		return nil, false, fmt.Errorf("Pipeline execution reached a failure status: %s", status)
+	}
+	//executions that ended can't reach the statuses anymore
+	if !spinnaker.ActiveStatus(status) {
 		concourse.Sayf("\n")
-		return false, fmt.Errorf("Pipeline execution reached a final state: %s", status)
+		return nil, false, fmt.Errorf("Pipeline execution reached a final state: %s", status)
+	}
+	if err := handleManualJudgments(ctx, pipelineExecutionID, rawPipeline, wait); err != nil {
+		return nil, false, err
 	}
 	concourse.Sayf(".")
-	return false, nil
+	return rawPipeline, false, nil
+}
+
+// writeDryRunResponse prints the trigger the pipeline would have been
+// executed with, so the wiring of the params can be checked safely. Concourse
+// needs a version even though no execution was started, and triggers jobs on
+// it like on any other, so dry runs belong on a resource no job triggers on.
+func writeDryRunResponse(request concourse.OutRequest, postBody []byte) {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, postBody, "", "  "); err != nil {
+		concourse.Fatal("put step failed", err)
+	}
+	concourse.Sayf("Dry run, not executing pipeline: '%s/%s' with trigger:\n%s\n", request.Source.SpinnakerApplication, request.Source.SpinnakerPipeline, indented.String())
+
+	concourse.WriteResponse(concourse.OutResponse{
+		Version:  concourse.Version{Ref: concourse.DryRunRef},
+		Metadata: []concourse.MetadataPair{{Name: "Dry run", Value: "true"}},
+	})
 }
 
-func writeSuccessfulResponse(pipelineExecutionID string) {
+func writeSuccessfulResponse(version concourse.Version, executionURL string) {
 	output := concourse.OutResponse{}
-	output.Version = concourse.Version{
-		Ref: pipelineExecutionID,
+	output.Version = version
+	if executionURL != "" {
+		concourse.Sayf("Execution: %s\n", executionURL)
+		output.Metadata = append(output.Metadata, concourse.MetadataPair{Name: "URL", Value: executionURL})
 	}
 
 	concourse.Sayf("Pipeline executed successfully")
@@ -188,7 +498,8 @@ func checkStatus(status string, statuses []string) bool {
 		return true
 	}
 	for _, currStatus := range statuses {
-		if status == currStatus {
+		//Spinnaker statuses are upper case, but the examples have long used lower case ones
+		if strings.EqualFold(status, currStatus) {
 			return true
 		}
 	}
@@ -0,0 +1,96 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// readParamsFile reads the trigger parameters an earlier step computed, as
+// YAML when the file has a .yml or .yaml extension and as JSON otherwise
+func readParamsFile(path string) (map[string]interface{}, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		var yamlParams map[string]interface{}
+		if err := yaml.Unmarshal(contents, &yamlParams); err != nil {
+			return nil, fmt.Errorf("invalid trigger params file %s: %s", path, err)
+		}
+		for key, value := range yamlParams {
+			params[key] = jsonValue(value)
+		}
+	default:
+		if err := json.Unmarshal(contents, &params); err != nil {
+			return nil, fmt.Errorf("invalid trigger params file %s: %s", path, err)
+		}
+	}
+	return params, nil
+}
+
+// buildMetadata are the variables Concourse sets to describe the build of a
+// put step, sent with build_metadata so Deck shows which build triggered the
+// execution
+var buildMetadata = []string{
+	"BUILD_ID",
+	"BUILD_NAME",
+	"BUILD_JOB_NAME",
+	"BUILD_PIPELINE_NAME",
+	"BUILD_TEAM_NAME",
+	"ATC_EXTERNAL_URL",
+}
+
+// fileValue replaces a {file: path} trigger parameter with the contents of
+// the file, such as a version or image digest a previous task wrote. The
+// other values are returned as they are.
+func fileValue(sourcesDir string, value interface{}) (interface{}, error) {
+	reference, ok := value.(map[string]interface{})
+	if !ok || len(reference) != 1 {
+		return value, nil
+	}
+	path, ok := reference["file"].(string)
+	if !ok {
+		return value, nil
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(sourcesDir, path))
+	if err != nil {
+		return nil, err
+	}
+	//files written with echo end with a newline that isn't part of the value
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// jsonValue converts the maps YAML decodes, which may have keys of any type,
+// to ones that can be encoded as JSON
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, nested := range value {
+			converted[fmt.Sprint(key)] = jsonValue(nested)
+		}
+		return converted
+	case []interface{}:
+		for i, nested := range value {
+			value[i] = jsonValue(nested)
+		}
+	}
+	return value
+}
@@ -10,19 +10,43 @@ Unless required by applicable law or agreed to in writing, software distributed
 package concourse
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/mitchellh/colorstring"
 )
 
+var exitHooks []func(failed bool)
+
+// OnExit registers a function to run just before the resource exits, with
+// whether the step failed
+func OnExit(hook func(failed bool)) {
+	exitHooks = append(exitHooks, hook)
+}
+
+func runExitHooks(failed bool) {
+	for _, hook := range exitHooks {
+		hook(failed)
+	}
+}
+
 func Fatal(doing string, err error) {
 	Sayf(colorstring.Color("[red]error %s: %s\n"), doing, err)
+	runExitHooks(true)
 	//TODO: don't exit here, let the caller decide.
 	os.Exit(1)
 }
 
+// SignalContext is cancelled when Concourse aborts the build, so in-flight
+// requests and polling stop promptly
+func SignalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+}
+
 func Sayf(message string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, message, args...)
 }
@@ -39,5 +63,6 @@ func WriteResponse(response interface{}) {
 	if err := json.NewEncoder(os.Stdout).Encode(response); err != nil {
 		Fatal("Error writing response: %v\n", err)
 	}
+	runExitHooks(false)
 	os.Exit(0)
 }
@@ -9,30 +9,316 @@ Unless required by applicable law or agreed to in writing, software distributed
 */
 package concourse
 
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Source fields tagged vault are credentials that are read from the vault
+// secret when they are not set
 type Source struct {
-	SpinnakerAPI         string   `json:"spinnaker_api"`
-	SpinnakerApplication string   `json:"spinnaker_application"`
-	SpinnakerPipeline    string   `json:"spinnaker_pipeline"`
-	Statuses             []string `json:"statuses"`
-	StatusCheckTimeout   string   `json:"status_check_timeout"`
-	StatusCheckInterval  string   `json:"status_check_interval"`
-	X509Cert             string   `json:"spinnaker_x509_cert"`
-	X509Key              string   `json:"spinnaker_x509_key"`
+	SpinnakerAPI            string            `json:"spinnaker_api"`
+	SpinnakerUI             string            `json:"spinnaker_ui"`
+	SpinnakerApplication    string            `json:"spinnaker_application"`
+	SpinnakerApplications   []string          `json:"spinnaker_applications"`
+	SpinnakerAppRegex       string            `json:"spinnaker_application_regex"`
+	SpinnakerPipeline       string            `json:"spinnaker_pipeline"`
+	SpinnakerPipelineID     string            `json:"spinnaker_pipeline_id"`
+	SpinnakerPipelines      []string          `json:"spinnaker_pipelines"`
+	SpinnakerPipelineRegex  string            `json:"spinnaker_pipeline_regex"`
+	NameRegex               string            `json:"name_regex"`
+	Statuses                []string          `json:"statuses"`
+	IgnoreCanceled          bool              `json:"ignore_canceled"`
+	CheckLimit              int               `json:"check_limit"`
+	OrderBy                 string            `json:"order_by"`
+	InitialMaxAge           string            `json:"initial_max_age"`
+	EmitStatusTransitions   bool              `json:"emit_status_transitions"`
+	CheckSoftFail           bool              `json:"check_soft_fail"`
+	TriggerTypes            []string          `json:"trigger_types"`
+	TriggeredBy             []string          `json:"triggered_by"`
+	IgnoreTriggeredBy       []string          `json:"ignore_triggered_by"`
+	MatchParameters         map[string]string `json:"match_parameters"`
+	RequireStage            RequiredStage     `json:"require_stage"`
+	MatchArtifact           ArtifactMatcher   `json:"match_artifact"`
+	TriggeredByMeOnly       bool              `json:"triggered_by_me_only"`
+	LazyValidation          bool              `json:"lazy_validation"`
+	RunAsUser               string            `json:"run_as_user"`
+	StatusCheckTimeout      string            `json:"status_check_timeout"`
+	StatusCheckInterval     string            `json:"status_check_interval"`
+	X509Cert                string            `json:"spinnaker_x509_cert" vault:"true"`
+	X509Key                 string            `json:"spinnaker_x509_key" vault:"true"`
+	X509CertPath            string            `json:"x509_cert_path"`
+	X509KeyPath             string            `json:"x509_key_path"`
+	X509KeyPassword         string            `json:"x509_key_password" vault:"true"`
+	CACert                  string            `json:"ca_cert"`
+	SkipTLSVerify           bool              `json:"skip_tls_verify"`
+	ConnectTimeout          string            `json:"connect_timeout"`
+	TLSHandshakeTimeout     string            `json:"tls_handshake_timeout"`
+	RequestTimeout          string            `json:"request_timeout"`
+	MaxIdleConns            int               `json:"max_idle_conns"`
+	IdleConnTimeout         string            `json:"idle_conn_timeout"`
+	DisableKeepAlives       bool              `json:"disable_keep_alives"`
+	HTTPProxy               string            `json:"http_proxy"`
+	HTTPSProxy              string            `json:"https_proxy"`
+	NoProxy                 string            `json:"no_proxy"`
+	AuthMethod              string            `json:"auth_method"`
+	OAuth2TokenURL          string            `json:"oauth2_token_url"`
+	OAuth2ClientID          string            `json:"oauth2_client_id"`
+	OAuth2ClientSecret      string            `json:"oauth2_client_secret" vault:"true"`
+	OAuth2Scopes            []string          `json:"oauth2_scopes"`
+	OIDCIssuerURL           string            `json:"oidc_issuer_url"`
+	OIDCClientID            string            `json:"oidc_client_id"`
+	OIDCClientSecret        string            `json:"oidc_client_secret" vault:"true"`
+	OIDCRefreshToken        string            `json:"oidc_refresh_token" vault:"true"`
+	BearerToken             string            `json:"bearer_token" vault:"true"`
+	APIKey                  string            `json:"api_key" vault:"true"`
+	APIKeyHeader            string            `json:"api_key_header"`
+	Username                string            `json:"username"`
+	Password                string            `json:"password" vault:"true"`
+	GCPServiceAccountKey    string            `json:"gcp_service_account_key" vault:"true"`
+	IAPClientID             string            `json:"iap_client_id"`
+	SAMLAssertion           string            `json:"saml_assertion" vault:"true"`
+	KerberosPrincipal       string            `json:"kerberos_principal"`
+	KerberosKeytab          string            `json:"kerberos_keytab" vault:"true"`
+	KerberosCCachePath      string            `json:"kerberos_ccache_path"`
+	KerberosKrb5Conf        string            `json:"kerberos_krb5_conf"`
+	KerberosSPN             string            `json:"kerberos_spn"`
+	AWSRegion               string            `json:"aws_region"`
+	AWSService              string            `json:"aws_service"`
+	RetryMaxAttempts        int               `json:"retry_max_attempts"`
+	RetryBackoff            string            `json:"retry_backoff"`
+	RetryStatusCodes        []int             `json:"retry_status_codes"`
+	RateLimit               float64           `json:"rate_limit"`
+	CircuitBreakerThreshold int               `json:"circuit_breaker_threshold"`
+	CircuitBreakerCooldown  string            `json:"circuit_breaker_cooldown"`
+	Vault                   Vault             `json:"vault"`
+	Debug                   bool              `json:"debug"`
+	PushgatewayURL          string            `json:"pushgateway_url"`
+	MetricsJob              string            `json:"metrics_job"`
+	OTLPEndpoint            string            `json:"otlp_endpoint"`
+	OTLPHeaders             map[string]string `json:"otlp_headers"`
+}
+
+// Applications returns the names of every application the resource watches by name
+func (s Source) Applications() []string {
+	var applications []string
+	if s.SpinnakerApplication != "" {
+		applications = append(applications, s.SpinnakerApplication)
+	}
+	return append(applications, s.SpinnakerApplications...)
+}
+
+// ApplicationRegex compiles spinnaker_application_regex so that it has to
+// match whole application names. It returns nil when no regex is configured.
+func (s Source) ApplicationRegex() (*regexp.Regexp, error) {
+	return compileWholeMatch(s.SpinnakerAppRegex, "spinnaker_application_regex")
+}
+
+// Pipelines returns the names of every pipeline the resource watches by name
+func (s Source) Pipelines() []string {
+	var pipelines []string
+	if s.SpinnakerPipeline != "" {
+		pipelines = append(pipelines, s.SpinnakerPipeline)
+	}
+	return append(pipelines, s.SpinnakerPipelines...)
+}
+
+// PipelineRegex compiles spinnaker_pipeline_regex so that it has to match
+// whole pipeline names. It returns nil when no regex is configured.
+func (s Source) PipelineRegex() (*regexp.Regexp, error) {
+	return compileWholeMatch(s.SpinnakerPipelineRegex, "spinnaker_pipeline_regex")
+}
+
+// WatchesApplication reports whether the source watches the executions of the
+// named application. Sources that name no application and have no regex watch
+// every application.
+func (s Source) WatchesApplication(name string) (bool, error) {
+	regex, err := s.ApplicationRegex()
+	if err != nil {
+		return false, err
+	}
+	return watches(name, s.Applications(), regex), nil
+}
+
+// WatchesPipeline reports whether the source watches the executions of the
+// named pipeline. Sources that name no pipeline and have no regex watch every
+// pipeline, except for the ones configured by a spinnaker_pipeline_id whose
+// name isn't resolved yet.
+func (s Source) WatchesPipeline(name string) (bool, error) {
+	regex, err := s.PipelineRegex()
+	if err != nil {
+		return false, err
+	}
+	if s.SpinnakerPipeline == "" && s.SpinnakerPipelineID != "" && len(s.SpinnakerPipelines) == 0 && regex == nil {
+		return false, nil
+	}
+	return watches(name, s.Pipelines(), regex), nil
+}
+
+func watches(name string, names []string, regex *regexp.Regexp) bool {
+	if len(names) == 0 && regex == nil {
+		return true
+	}
+	for _, configured := range names {
+		if name == configured {
+			return true
+		}
+	}
+	return regex != nil && regex.MatchString(name)
+}
+
+// ExecutionNameRegex compiles name_regex, which may match any part of the
+// execution names. It returns nil when no regex is configured.
+func (s Source) ExecutionNameRegex() (*regexp.Regexp, error) {
+	if s.NameRegex == "" {
+		return nil, nil
+	}
+	regex, err := regexp.Compile(s.NameRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name_regex: %s", err)
+	}
+	return regex, nil
+}
+
+// ExecutionURL links to the execution in Deck, or is empty when no
+// spinnaker_ui is configured
+func (s Source) ExecutionURL(application, executionID string) string {
+	if s.SpinnakerUI == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/#/applications/%s/executions/details/%s", strings.TrimSuffix(s.SpinnakerUI, "/"), application, executionID)
+}
+
+func compileWholeMatch(expr, field string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	regex, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", field, err)
+	}
+	return regex, nil
+}
+
+type Vault struct {
+	Address    string `json:"address"`
+	AuthMount  string `json:"auth_mount"`
+	RoleID     string `json:"role_id"`
+	SecretID   string `json:"secret_id"`
+	SecretPath string `json:"secret_path"`
+}
+
+type RequiredStage struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// ArtifactMatcher selects the executions whose trigger brought in a matching artifact
+type ArtifactMatcher struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Regexes compiles the name and version of the matcher so that they have to
+// match whole artifact names and versions. They are nil when not configured.
+func (m ArtifactMatcher) Regexes() (*regexp.Regexp, *regexp.Regexp, error) {
+	name, err := compileWholeMatch(m.Name, "match_artifact name")
+	if err != nil {
+		return nil, nil, err
+	}
+	version, err := compileWholeMatch(m.Version, "match_artifact version")
+	if err != nil {
+		return nil, nil, err
+	}
+	return name, version, nil
 }
 
 type Version struct {
-	Ref string `json:"ref"`
+	Ref         string `json:"ref"`
+	Application string `json:"application,omitempty"`
+	Pipeline    string `json:"pipeline,omitempty"`
+	Status      string `json:"status,omitempty"`
+	BuildTime   string `json:"buildTime,omitempty"`
 }
 
+// DryRunRef is the version a put with dry_run emits, which has no execution
+const DryRunRef = "dry-run"
+
 type MetadataPair struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
 }
 
 type OutParams struct {
-	TriggerParams             map[string]string `json:"trigger_params,omitempty"` // optional
-	Artifacts                 string            `json:"artifacts_json_file"`      // optional
-	TriggerParamsJSONFilePath string            `json:"trigger_params_json_file"` //optional
+	Pipeline                  string                   `json:"pipeline,omitempty"`            // optional
+	PipelineID                string                   `json:"pipeline_id,omitempty"`         // optional
+	TriggerParams             map[string]interface{}   `json:"trigger_params,omitempty"`      // optional
+	Artifacts                 string                   `json:"artifacts_json_file"`           // optional
+	TriggerParamsJSONFilePath string                   `json:"trigger_params_json_file"`      // deprecated, use trigger_params_file
+	TriggerParamsFile         string                   `json:"trigger_params_file,omitempty"` // optional
+	BuildMetadata             bool                     `json:"build_metadata,omitempty"`      // optional
+	InputArtifacts            []InputArtifact          `json:"artifacts,omitempty"`           // optional
+	WaitForCompletion         bool                     `json:"wait_for_completion,omitempty"` // optional
+	PollInterval              string                   `json:"poll_interval,omitempty"`       // optional
+	Timeout                   string                   `json:"timeout,omitempty"`             // optional
+	SuccessStatuses           []string                 `json:"success_statuses,omitempty"`    // optional
+	FailureStatuses           []string                 `json:"failure_statuses,omitempty"`    // optional
+	CancelOnAbort             bool                     `json:"cancel_on_abort,omitempty"`     // optional
+	ManualJudgment            string                   `json:"manual_judgment,omitempty"`     // optional
+	JudgmentInput             string                   `json:"judgment_input,omitempty"`      // optional
+	DryRun                    bool                     `json:"dry_run,omitempty"`             // optional
+	Idempotent                bool                     `json:"idempotent,omitempty"`          // optional
+	EventID                   string                   `json:"event_id,omitempty"`            // optional
+	RunAsUser                 string                   `json:"run_as_user,omitempty"`         // optional
+	ServiceAccount            string                   `json:"service_account,omitempty"`     // optional
+	Notifications             []map[string]interface{} `json:"notifications,omitempty"`       // optional
+	Restart                   *RestartParams           `json:"restart,omitempty"`             // optional
+	Action                    string                   `json:"action,omitempty"`              // optional
+	ExecutionID               string                   `json:"execution_id,omitempty"`        // optional
+	Reason                    string                   `json:"reason,omitempty"`              // optional
+}
+
+// RestartParams select the TERMINAL execution a put restarts from its failed stage
+type RestartParams struct {
+	ExecutionID string `json:"execution_id"`
+}
+
+// InputArtifact declares a Spinnaker artifact to trigger a pipeline with,
+// read from an input of the put step when Input is set, or embedding File
+// in embedded/base64 ones
+type InputArtifact struct {
+	Input           string `json:"input,omitempty"`
+	File            string `json:"file,omitempty"`
+	Type            string `json:"type"`
+	Name            string `json:"name,omitempty"`
+	Version         string `json:"version,omitempty"`
+	Reference       string `json:"reference,omitempty"`
+	ArtifactAccount string `json:"artifact_account,omitempty"`
+}
+
+type InParams struct {
+	SkipDownload      bool              `json:"skip_download,omitempty"`       // optional
+	Outputs           bool              `json:"outputs,omitempty"`             // optional
+	DownloadArtifacts bool              `json:"download_artifacts,omitempty"`  // optional
+	Images            bool              `json:"images,omitempty"`              // optional
+	Deployments       bool              `json:"deployments,omitempty"`         // optional
+	EntityTags        bool              `json:"entity_tags,omitempty"`         // optional
+	Logs              bool              `json:"logs,omitempty"`                // optional
+	Children          bool              `json:"children,omitempty"`            // optional
+	Extract           map[string]string `json:"extract,omitempty"`             // optional
+	JUnit             bool              `json:"junit,omitempty"`               // optional
+	Timeline          bool              `json:"timeline,omitempty"`            // optional
+	Variables         bool              `json:"variables,omitempty"`           // optional
+	Webhooks          bool              `json:"webhooks,omitempty"`            // optional
+	EventID           string            `json:"event_id,omitempty"`            // optional
+	MaxContextSize    int               `json:"max_context_size,omitempty"`    // optional
+	RedactContextKeys []string          `json:"redact_context_keys,omitempty"` // optional
+	JSONFormat        string            `json:"json_format,omitempty"`         // optional
+	Compress          string            `json:"compress,omitempty"`            // optional
+	Wait              bool              `json:"wait,omitempty"`                // optional
+	WaitTimeout       string            `json:"wait_timeout,omitempty"`        // optional
 }
 
 type CheckRequest struct {
@@ -40,9 +326,9 @@ type CheckRequest struct {
 	Version `json:"version"`
 }
 type InRequest struct {
-	Source  Source    `json:"source"`
-	Version Version   `json:"version"`
-	Params  OutParams `json:"params"`
+	Source  Source   `json:"source"`
+	Version Version  `json:"version"`
+	Params  InParams `json:"params"`
 }
 type OutRequest struct {
 	Source Source    `json:"source"`
@@ -67,6 +353,13 @@ type IntermediateMetadata struct {
 	StartTime       int64  `json:"startTime"`
 	EndTime         int64  `json:"endTime"`
 	Status          string `json:"status"`
+	Trigger         struct {
+		User string `json:"user"`
+	} `json:"trigger"`
+	Stages []struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	} `json:"stages"`
 }
 
 type InResponse struct {
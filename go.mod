@@ -1,7 +1,17 @@
 module github.com/pivotal-cf/spinnaker-resource
 
+go 1.16
+
 require (
+	github.com/PaesslerAG/gval v1.0.0
+	github.com/PaesslerAG/jsonpath v0.1.1
+	github.com/aws/aws-sdk-go-v2 v1.17.8
+	github.com/aws/aws-sdk-go-v2/config v1.18.19
+	github.com/jcmturner/gokrb5/v8 v8.4.4
 	github.com/mitchellh/colorstring v0.0.0-20150917214807-8631ce90f286
 	github.com/onsi/ginkgo v1.6.0
 	github.com/onsi/gomega v1.4.2
+	github.com/youmark/pkcs8 v0.0.0-20201027041543-1326539a0a0a
+	golang.org/x/net v0.7.0
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -12,15 +12,23 @@ package integration_test
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 	"github.com/onsi/gomega/ghttp"
 
 	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
 )
 
 var _ = Describe("Check", func() {
@@ -37,6 +45,26 @@ var _ = Describe("Check", func() {
 		inputRef                      string
 		checkSess                     *gexec.Session
 		statuses                      []string
+		pushgatewayURL                string
+		checkLimit                    int
+		triggerTypes                  []string
+		matchParameters               map[string]string
+		requireStage                  concourse.RequiredStage
+		spinnakerPipelines            []string
+		pipelineRegex                 string
+		applications                  []string
+		triggeredByMeOnly             bool
+		orderBy                       string
+		ignoreCanceled                bool
+		initialMaxAge                 string
+		emitStatusTransitions         bool
+		checkSoftFail                 bool
+		inputStatus                   string
+		triggeredBy                   []string
+		ignoreTriggeredBy             []string
+		lazyValidation                bool
+		nameRegex                     string
+		matchArtifact                 concourse.ArtifactMatcher
 	)
 	pipelineName = "foo"
 	applicationName = "bar"
@@ -73,6 +101,7 @@ var _ = Describe("Check", func() {
 		},
 	}
 	JustBeforeEach(func() {
+		checkResponse = nil
 		spinnakerServer.AppendHandlers(
 			ghttp.CombineHandlers(
 				ghttp.VerifyRequest("GET", MatchRegexp(".*/applications/"+applicationName)),
@@ -87,27 +116,39 @@ var _ = Describe("Check", func() {
 						"name":     applicationName,
 					},
 				)),
-			ghttp.CombineHandlers(
-				ghttp.VerifyRequest("GET", MatchRegexp(".*/applications/"+applicationName+"/pipelineConfigs")),
-				ghttp.RespondWithJSONEncoded(
-					statusCode,
-					[]map[string]string{
-						{"name": pipelineName},
-					},
-				)),
 			allHandler,
 		)
 		input = concourse.CheckRequest{
 			Source: concourse.Source{
-				SpinnakerAPI:         spinnakerServer.URL(),
-				SpinnakerApplication: applicationName,
-				SpinnakerPipeline:    pipelineName,
-				Statuses:             statuses,
-				X509Cert:             serverCert,
-				X509Key:              serverKey,
+				SpinnakerAPI:           spinnakerServer.URL(),
+				SpinnakerApplication:   applicationName,
+				SpinnakerApplications:  applications,
+				SpinnakerPipeline:      pipelineName,
+				SpinnakerPipelines:     spinnakerPipelines,
+				SpinnakerPipelineRegex: pipelineRegex,
+				Statuses:               statuses,
+				X509Cert:               serverCert,
+				X509Key:                serverKey,
+				PushgatewayURL:         pushgatewayURL,
+				CheckLimit:             checkLimit,
+				TriggerTypes:           triggerTypes,
+				MatchParameters:        matchParameters,
+				RequireStage:           requireStage,
+				TriggeredByMeOnly:      triggeredByMeOnly,
+				OrderBy:                orderBy,
+				IgnoreCanceled:         ignoreCanceled,
+				InitialMaxAge:          initialMaxAge,
+				EmitStatusTransitions:  emitStatusTransitions,
+				CheckSoftFail:          checkSoftFail,
+				TriggeredBy:            triggeredBy,
+				IgnoreTriggeredBy:      ignoreTriggeredBy,
+				LazyValidation:         lazyValidation,
+				NameRegex:              nameRegex,
+				MatchArtifact:          matchArtifact,
 			},
 			Version: concourse.Version{
-				Ref: inputRef,
+				Ref:    inputRef,
+				Status: inputStatus,
 			},
 		}
 		marshalledInput, err = json.Marshal(input)
@@ -119,15 +160,46 @@ var _ = Describe("Check", func() {
 		<-checkSess.Exited
 	})
 	Context("when input version is not empty", func() {
+		var existingExecutions []map[string]interface{}
+
 		BeforeEach(func() {
 			statusCode = 200
+			existingExecutions = pipelineExecutions
 			allHandler = ghttp.CombineHandlers(
-				ghttp.VerifyRequest("GET", MatchRegexp(".*/applications/"+applicationName+"/pipelines"), "limit=25"),
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
 				ghttp.RespondWithJSONEncoded(
 					statusCode,
 					pipelineExecutions,
 				),
 			)
+
+			//the previously emitted version is looked up for its buildTime
+			spinnakerServer.RouteToHandler("GET", regexp.MustCompile("^/pipelines/EX[0-9]+$"), func(w http.ResponseWriter, r *http.Request) {
+				for _, execution := range existingExecutions {
+					if execution["id"] == path.Base(r.URL.Path) {
+						json.NewEncoder(w).Encode(execution)
+						return
+					}
+				}
+				w.WriteHeader(404)
+			})
+			//and used as the cursor to search for every execution since
+			spinnakerServer.RouteToHandler("GET", "/applications/"+applicationName+"/executions/search", func(w http.ResponseWriter, r *http.Request) {
+				//without a boundary the most recent executions are searched for
+				since, _ := strconv.Atoi(r.URL.Query().Get("triggerTimeStartBoundary"))
+				Expect(r.URL.Query().Get("startIndex")).To(Equal("0"))
+				Expect(r.URL.Query().Get("size")).To(Equal("25"))
+				Expect(r.URL.Query().Get("pipelineName")).To(Equal(pipelineName))
+				Expect(r.URL.Query().Get("statuses")).To(Equal(strings.ToUpper(strings.Join(statuses, ","))))
+
+				executions := []map[string]interface{}{}
+				for _, execution := range existingExecutions {
+					if execution["buildTime"].(int) >= since {
+						executions = append(executions, execution)
+					}
+				}
+				json.NewEncoder(w).Encode(executions)
+			})
 		})
 		Context("when statuses are specified in the resource params", func() {
 			BeforeEach(func() {
@@ -145,6 +217,77 @@ var _ = Describe("Check", func() {
 				Expect(checkResponse[1].Ref).To(Equal(pipelineExecutions[1]["id"].(string)))
 			})
 		})
+		Context("when the execution of the input version has changed status since", func() {
+			BeforeEach(func() {
+				existingExecutions = []map[string]interface{}{
+					{"id": "EX10", "name": pipelineName, "buildTime": 1543244700, "startTime": 1543244700, "endTime": 1543244900, "status": "SUCCEEDED"},
+					{"id": "EX11", "name": pipelineName, "buildTime": 1543244800, "startTime": 1543244800, "status": "RUNNING"},
+				}
+				allHandler = ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+					ghttp.RespondWithJSONEncoded(statusCode, existingExecutions),
+				)
+				inputRef = "EX10"
+				inputStatus = "RUNNING"
+				statuses = []string{}
+			})
+
+			AfterEach(func() {
+				inputStatus = ""
+				emitStatusTransitions = false
+			})
+
+			It("keeps the status the input version was emitted with", func() {
+				Expect(checkSess.ExitCode()).To(Equal(0))
+
+				err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(checkResponse).To(Equal([]concourse.Version{
+					{Ref: "EX10", Status: "RUNNING", BuildTime: "1543244700"},
+					{Ref: "EX11", Status: "RUNNING", BuildTime: "1543244800"},
+				}))
+			})
+
+			Context("when status transitions are emitted", func() {
+				BeforeEach(func() {
+					emitStatusTransitions = true
+				})
+
+				It("emits the execution again, after the ones that started before it ended", func() {
+					Expect(checkSess.ExitCode()).To(Equal(0))
+
+					err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(checkResponse).To(Equal([]concourse.Version{
+						{Ref: "EX11", Status: "RUNNING", BuildTime: "1543244800"},
+						{Ref: "EX10", Status: "SUCCEEDED", BuildTime: "1543244700"},
+					}))
+				})
+			})
+		})
+		Context("when the input version no longer matches the statuses", func() {
+			BeforeEach(func() {
+				existingExecutions = []map[string]interface{}{
+					{"id": "EX10", "name": pipelineName, "buildTime": 1543244700, "status": "TERMINAL"},
+					{"id": "EX12", "name": pipelineName, "buildTime": 1543244710, "status": "SUCCEEDED"},
+					{"id": "EX11", "name": pipelineName, "buildTime": 1543244700, "status": "SUCCEEDED"},
+					{"id": "EX12", "name": pipelineName, "buildTime": 1543244710, "status": "SUCCEEDED"},
+				}
+				inputRef = "EX10"
+				statuses = []string{"SUCCEEDED"}
+			})
+
+			It("returns every version since, oldest first and only once", func() {
+				Expect(checkSess.ExitCode()).To(Equal(0))
+
+				err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(checkResponse).To(Equal([]concourse.Version{
+					{Ref: "EX11", Status: "SUCCEEDED", BuildTime: "1543244700"},
+					{Ref: "EX12", Status: "SUCCEEDED", BuildTime: "1543244710"},
+				}))
+			})
+		})
 		Context("when statuses are not specified in the resource params", func() {
 			Context("when input version exists but not the latest version", func() {
 				BeforeEach(func() {
@@ -183,8 +326,9 @@ var _ = Describe("Check", func() {
 						pipelineExecutions[2],
 						pipelineExecutions[3],
 					}
+					existingExecutions = responseMap
 					allHandler = ghttp.CombineHandlers(
-						ghttp.VerifyRequest("GET", MatchRegexp(".*/applications/"+applicationName+"/pipelines"), "limit=25"),
+						ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
 						ghttp.RespondWithJSONEncoded(
 							statusCode,
 							responseMap,
@@ -204,6 +348,630 @@ var _ = Describe("Check", func() {
 			})
 		})
 	})
+	Context("when Gate fails", func() {
+		BeforeEach(func() {
+			inputRef = "EX1"
+			statuses = []string{}
+			statusCode = 200
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/pipelines/EX1"),
+				ghttp.RespondWith(500, "down for maintenance"),
+			)
+		})
+
+		AfterEach(func() {
+			inputRef = ""
+		})
+
+		It("fails the check", func() {
+			Expect(checkSess.ExitCode()).To(Equal(1))
+			Expect(checkSess.Err).To(gbytes.Say("down for maintenance"))
+		})
+
+		Context("when soft failing is configured", func() {
+			BeforeEach(func() {
+				checkSoftFail = true
+			})
+
+			AfterEach(func() {
+				checkSoftFail = false
+			})
+
+			It("warns and returns the previous version", func() {
+				Expect(checkSess.ExitCode()).To(Equal(0))
+				Expect(checkSess.Err).To(gbytes.Say("WARNING: check step failed: .*down for maintenance"))
+
+				err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX1"}}))
+			})
+		})
+	})
+
+	Context("when a check limit is configured", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			checkLimit = 100
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=100&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, pipelineExecutions),
+			)
+		})
+
+		AfterEach(func() {
+			checkLimit = 0
+		})
+
+		It("fetches that many executions", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX3", Status: "TERMINAL", BuildTime: "1543244690"}}))
+		})
+	})
+
+	Context("when the input version is the one of a dry run", func() {
+		BeforeEach(func() {
+			inputRef = "dry-run"
+			statuses = []string{}
+			statusCode = 200
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": 1543244670, "status": "SUCCEEDED"},
+					{"id": "EX2", "name": pipelineName, "buildTime": 1543244680, "status": "SUCCEEDED"},
+				}),
+			)
+		})
+
+		It("returns the latest execution without looking the version up", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX2", Status: "SUCCEEDED", BuildTime: "1543244680"}}))
+		})
+	})
+
+	Context("when ordering by end time", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			orderBy = "end_time"
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": 1543244670, "endTime": 1543244900, "status": "SUCCEEDED"},
+					{"id": "EX2", "name": pipelineName, "buildTime": 1543244680, "endTime": 1543244700, "status": "SUCCEEDED"},
+					{"id": "EX3", "name": pipelineName, "buildTime": 1543244690, "status": "RUNNING"},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			orderBy = ""
+		})
+
+		It("returns the execution that finished last, leaving out the ones still running", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX1", Status: "SUCCEEDED", BuildTime: "1543244670"}}))
+		})
+	})
+
+	Context("when an initial max age is configured", func() {
+		var (
+			executions      []map[string]interface{}
+			ignoresBoundary bool
+		)
+
+		BeforeEach(func() {
+			ignoresBoundary = false
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			initialMaxAge = "72h"
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search"),
+				func(w http.ResponseWriter, r *http.Request) {
+					since, err := strconv.ParseInt(r.URL.Query().Get("triggerTimeStartBoundary"), 10, 64)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(since).To(BeNumerically("~", time.Now().Add(-72*time.Hour).UnixNano()/int64(time.Millisecond), 60000))
+
+					matching := []map[string]interface{}{}
+					for _, execution := range executions {
+						if ignoresBoundary || execution["buildTime"].(int64) >= since {
+							matching = append(matching, execution)
+						}
+					}
+					json.NewEncoder(w).Encode(matching)
+				},
+			)
+		})
+
+		AfterEach(func() {
+			initialMaxAge = ""
+		})
+
+		Context("and the latest execution is older", func() {
+			BeforeEach(func() {
+				executions = []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": time.Now().Add(-100*time.Hour).UnixNano() / int64(time.Millisecond), "status": "SUCCEEDED"},
+				}
+			})
+
+			It("returns no versions", func() {
+				Expect(checkSess.ExitCode()).To(Equal(0))
+
+				err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(checkResponse).To(BeEmpty())
+			})
+
+			Context("and Gate ignores the boundary", func() {
+				BeforeEach(func() {
+					ignoresBoundary = true
+				})
+
+				It("still returns no versions", func() {
+					Expect(checkSess.ExitCode()).To(Equal(0))
+
+					err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(checkResponse).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("and the latest execution is more recent", func() {
+			BeforeEach(func() {
+				executions = []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": time.Now().Add(-100*time.Hour).UnixNano() / int64(time.Millisecond), "status": "SUCCEEDED"},
+					{"id": "EX2", "name": pipelineName, "buildTime": time.Now().Add(-time.Hour).UnixNano() / int64(time.Millisecond), "status": "SUCCEEDED"},
+				}
+			})
+
+			It("returns it", func() {
+				Expect(checkSess.ExitCode()).To(Equal(0))
+
+				err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(checkResponse).To(HaveLen(1))
+				Expect(checkResponse[0].Ref).To(Equal("EX2"))
+			})
+		})
+	})
+
+	Context("when canceled executions are ignored", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			ignoreCanceled = true
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": 1543244670, "status": "SUCCEEDED"},
+					{"id": "EX2", "name": pipelineName, "buildTime": 1543244680, "status": "TERMINAL", "canceled": true},
+					{"id": "EX3", "name": pipelineName, "buildTime": 1543244690, "status": "CANCELED"},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			ignoreCanceled = false
+		})
+
+		It("never returns them", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX1", Status: "SUCCEEDED", BuildTime: "1543244670"}}))
+		})
+	})
+
+	Context("when trigger types are configured", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			triggerTypes = []string{"manual", "webhook"}
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": 1543244670, "status": "SUCCEEDED", "trigger": map[string]interface{}{"type": "webhook"}},
+					{"id": "EX2", "name": pipelineName, "buildTime": 1543244680, "status": "SUCCEEDED", "trigger": map[string]interface{}{"type": "cron"}},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			triggerTypes = nil
+		})
+
+		It("ignores executions started by other triggers", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX1", Status: "SUCCEEDED", BuildTime: "1543244670"}}))
+		})
+	})
+
+	Context("when triggering users are configured", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			triggeredBy = []string{"deployer", "developer@example.com"}
+			ignoreTriggeredBy = []string{"Developer@example.com"}
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": 1543244670, "status": "SUCCEEDED", "trigger": map[string]interface{}{"user": "deployer"}},
+					{"id": "EX2", "name": pipelineName, "buildTime": 1543244680, "status": "SUCCEEDED", "trigger": map[string]interface{}{"user": "developer@example.com"}},
+					{"id": "EX3", "name": pipelineName, "buildTime": 1543244690, "status": "SUCCEEDED", "trigger": map[string]interface{}{"user": "anonymous"}},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			triggeredBy = nil
+			ignoreTriggeredBy = nil
+		})
+
+		It("only returns executions triggered by those users and not ignored", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX1", Status: "SUCCEEDED", BuildTime: "1543244670"}}))
+		})
+	})
+
+	Context("when parameters to match are configured", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			matchParameters = map[string]string{"environment": "prod", "replicas": "3"}
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": 1543244670, "status": "SUCCEEDED", "trigger": map[string]interface{}{"parameters": map[string]interface{}{"environment": "prod", "replicas": 3}}},
+					{"id": "EX2", "name": pipelineName, "buildTime": 1543244680, "status": "SUCCEEDED", "trigger": map[string]interface{}{"parameters": map[string]interface{}{"environment": "staging", "replicas": 3}}},
+					{"id": "EX3", "name": pipelineName, "buildTime": 1543244690, "status": "SUCCEEDED", "trigger": map[string]interface{}{}},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			matchParameters = nil
+		})
+
+		It("only returns executions triggered with those parameters", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX1", Status: "SUCCEEDED", BuildTime: "1543244670"}}))
+		})
+	})
+
+	Context("when a stage is required", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			requireStage = concourse.RequiredStage{Name: "Deploy to prod"}
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": 1543244670, "status": "TERMINAL", "stages": []map[string]interface{}{
+						{"name": "Deploy to prod", "status": "SUCCEEDED"},
+						{"name": "Smoke test", "status": "TERMINAL"},
+					}},
+					{"id": "EX2", "name": pipelineName, "buildTime": 1543244680, "status": "TERMINAL", "stages": []map[string]interface{}{
+						{"name": "Deploy to prod", "status": "TERMINAL"},
+					}},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			requireStage = concourse.RequiredStage{}
+		})
+
+		It("only returns executions in which the stage reached the status", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX1", Status: "TERMINAL", BuildTime: "1543244670"}}))
+		})
+	})
+
+	Context("when a trigger artifact has to match", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			matchArtifact = concourse.ArtifactMatcher{Type: "docker/image", Name: "gcr.io/acme/web.*", Version: `v1\..*`}
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": 1543244670, "status": "SUCCEEDED", "trigger": map[string]interface{}{
+						"artifacts": []map[string]interface{}{{"type": "docker/image", "name": "gcr.io/acme/web-frontend", "version": "v1.4.0"}},
+					}},
+					{"id": "EX2", "name": pipelineName, "buildTime": 1543244680, "status": "SUCCEEDED", "trigger": map[string]interface{}{
+						"artifacts": []map[string]interface{}{{"type": "docker/image", "name": "gcr.io/acme/web-frontend", "version": "v2.0.0"}},
+					}},
+					{"id": "EX3", "name": pipelineName, "buildTime": 1543244690, "status": "SUCCEEDED", "trigger": map[string]interface{}{
+						"artifacts": []map[string]interface{}{{"type": "docker/image", "name": "gcr.io/acme/worker", "version": "v1.4.0"}},
+					}},
+					{"id": "EX4", "name": pipelineName, "buildTime": 1543244700, "status": "SUCCEEDED"},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			matchArtifact = concourse.ArtifactMatcher{}
+		})
+
+		It("only returns executions triggered with a matching artifact", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX1", Status: "SUCCEEDED", BuildTime: "1543244670"}}))
+		})
+	})
+
+	Context("when only executions triggered by the resource are wanted", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			triggeredByMeOnly = true
+			eventID, err := spinnaker.NewEventID(concourse.Source{
+				SpinnakerAPI:         spinnakerServer.URL(),
+				SpinnakerApplication: applicationName,
+				SpinnakerPipeline:    pipelineName,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": pipelineName, "buildTime": 1543244670, "status": "SUCCEEDED", "trigger": map[string]interface{}{"type": "concourse-resource", "eventId": eventID}},
+					{"id": "EX2", "name": pipelineName, "buildTime": 1543244680, "status": "SUCCEEDED", "trigger": map[string]interface{}{"type": "manual"}},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			triggeredByMeOnly = false
+		})
+
+		It("ignores the executions triggered by anything else", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX1", Status: "SUCCEEDED", BuildTime: "1543244670"}}))
+		})
+	})
+
+	Context("when several pipelines are configured", func() {
+		BeforeEach(func() {
+			inputRef = "EX1"
+			statuses = []string{}
+			statusCode = 200
+			spinnakerPipelines = []string{"other-pipeline"}
+			executions := []map[string]interface{}{
+				{"id": "EX1", "name": pipelineName, "buildTime": 1543244670, "status": "SUCCEEDED"},
+				{"id": "EX2", "name": "other-pipeline", "buildTime": 1543244680, "status": "SUCCEEDED"},
+				{"id": "EX3", "name": "unwatched-pipeline", "buildTime": 1543244685, "status": "SUCCEEDED"},
+				{"id": "EX4", "name": pipelineName, "buildTime": 1543244690, "status": "SUCCEEDED"},
+			}
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/pipelines/EX1"),
+				ghttp.RespondWithJSONEncoded(statusCode, executions[0]),
+			)
+			spinnakerServer.RouteToHandler("GET", "/applications/"+applicationName+"/executions/search", ghttp.RespondWithJSONEncoded(statusCode, executions))
+		})
+
+		AfterEach(func() {
+			spinnakerPipelines = nil
+		})
+
+		It("merges their executions in order, naming the pipeline in the versions", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{
+				{Ref: "EX1", Pipeline: pipelineName, Status: "SUCCEEDED", BuildTime: "1543244670"},
+				{Ref: "EX2", Pipeline: "other-pipeline", Status: "SUCCEEDED", BuildTime: "1543244680"},
+				{Ref: "EX4", Pipeline: pipelineName, Status: "SUCCEEDED", BuildTime: "1543244690"},
+			}))
+		})
+	})
+
+	Context("when a pipeline regex is configured", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			pipelineRegex = "deploy-.*"
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25"),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": "deploy-api", "buildTime": 1543244670, "status": "SUCCEEDED"},
+					{"id": "EX2", "name": "deploy-web", "buildTime": 1543244680, "status": "SUCCEEDED"},
+					{"id": "EX3", "name": "redeploy-web", "buildTime": 1543244690, "status": "SUCCEEDED"},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			pipelineRegex = ""
+		})
+
+		It("watches the pipelines whose whole name matches", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX2", Pipeline: "deploy-web", Status: "SUCCEEDED", BuildTime: "1543244680"}}))
+		})
+	})
+
+	Context("when an execution name regex is configured", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			pipelineRegex = "deploy-.*"
+			nameRegex = "-api$"
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25"),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+					{"id": "EX1", "name": "deploy-api", "buildTime": 1543244670, "status": "SUCCEEDED"},
+					{"id": "EX2", "name": "deploy-web", "buildTime": 1543244680, "status": "SUCCEEDED"},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			pipelineRegex = ""
+			nameRegex = ""
+		})
+
+		It("only emits the executions whose name matches", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX1", Pipeline: "deploy-api", Status: "SUCCEEDED", BuildTime: "1543244670"}}))
+		})
+
+		Context("when the regex is invalid", func() {
+			BeforeEach(func() {
+				nameRegex = "("
+			})
+
+			It("fails", func() {
+				Expect(checkSess.ExitCode()).To(Equal(1))
+				Expect(checkSess.Err).To(gbytes.Say("invalid name_regex"))
+			})
+		})
+	})
+
+	Context("when several applications are configured", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			applications = []string{"baz"}
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/baz"),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{"name": "baz"}),
+			)
+			spinnakerServer.RouteToHandler("GET", "/applications/"+applicationName+"/executions/search", ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+				{"id": "EX1", "name": pipelineName, "application": applicationName, "buildTime": 1543244670, "status": "SUCCEEDED"},
+			}))
+			spinnakerServer.RouteToHandler("GET", "/applications/baz/executions/search", ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{
+				{"id": "EX2", "name": pipelineName, "application": "baz", "buildTime": 1543244680, "status": "SUCCEEDED"},
+			}))
+		})
+
+		AfterEach(func() {
+			applications = nil
+		})
+
+		It("aggregates their executions, naming the application in the versions", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX2", Application: "baz", Status: "SUCCEEDED", BuildTime: "1543244680"}}))
+			Expect(spinnakerServer.ReceivedRequests()).To(HaveLen(4))
+		})
+	})
+
+	Context("when lazy_validation is set", func() {
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			lazyValidation = true
+			spinnakerServer.RouteToHandler("GET", "/applications/"+applicationName+"/executions/search", ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, pipelineExecutions),
+			))
+		})
+
+		AfterEach(func() {
+			lazyValidation = false
+		})
+
+		It("only fetches the executions", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+
+			err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkResponse).To(Equal([]concourse.Version{{Ref: "EX3", Status: "TERMINAL", BuildTime: "1543244690"}}))
+			Expect(spinnakerServer.ReceivedRequests()).To(HaveLen(1))
+		})
+	})
+
+	Context("when a pushgateway is configured", func() {
+		var pushgateway *ghttp.Server
+
+		BeforeEach(func() {
+			inputRef = ""
+			statuses = []string{}
+			statusCode = 200
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
+				ghttp.RespondWithJSONEncoded(statusCode, pipelineExecutions),
+			)
+
+			pushgateway = ghttp.NewServer()
+			pushgateway.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("PUT", "/metrics/job/spinnaker_resource/step/check/application/"+applicationName+"/pipeline/"+pipelineName),
+				func(w http.ResponseWriter, r *http.Request) {
+					body, err := ioutil.ReadAll(r.Body)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(string(body)).To(ContainSubstring("# TYPE spinnaker_resource_last_run_api_requests gauge"))
+					Expect(string(body)).To(ContainSubstring(`spinnaker_resource_last_run_api_requests{code="200"} 2`))
+					Expect(string(body)).To(ContainSubstring(`spinnaker_resource_last_run_api_requests_within_seconds{le="+Inf"} 2`))
+					Expect(string(body)).To(ContainSubstring("spinnaker_resource_last_run_failed 0"))
+					Expect(string(body)).ToNot(ContainSubstring("counter"))
+				},
+				ghttp.RespondWith(200, ""),
+			))
+			pushgatewayURL = pushgateway.URL()
+		})
+
+		AfterEach(func() {
+			pushgateway.Close()
+			pushgatewayURL = ""
+		})
+
+		It("pushes the metrics of the check", func() {
+			Expect(checkSess.ExitCode()).To(Equal(0))
+			Expect(pushgateway.ReceivedRequests()).To(HaveLen(1))
+		})
+	})
+
 	Context("when input version is empty", func() {
 		BeforeEach(func() {
 			inputRef = ""
@@ -218,7 +986,11 @@ var _ = Describe("Check", func() {
 			statuses = []string{}
 			statusCode = 200
 			allHandler = ghttp.CombineHandlers(
-				ghttp.VerifyRequest("GET", MatchRegexp(".*/applications/"+applicationName+"/pipelines"), "limit=25"),
+				ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search"),
+				func(w http.ResponseWriter, r *http.Request) {
+					Expect(r.URL.Query().Get("pipelineName")).To(Equal(pipelineName))
+					Expect(r.URL.Query().Get("statuses")).To(Equal(strings.ToUpper(strings.Join(statuses, ","))))
+				},
 				ghttp.RespondWithJSONEncoded(
 					statusCode,
 					responseMap,
@@ -239,6 +1011,21 @@ var _ = Describe("Check", func() {
 				Expect(checkResponse[0].Ref).To(Equal(pipelineExecutions[1]["id"].(string)))
 			})
 
+			Context("when the statuses are lower case", func() {
+				BeforeEach(func() {
+					statuses = []string{"succeeded"}
+				})
+
+				It("matches them regardless of case", func() {
+					Expect(checkSess.ExitCode()).To(Equal(0))
+
+					err = json.Unmarshal(checkSess.Out.Contents(), &checkResponse)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(len(checkResponse)).To(Equal(1))
+					Expect(checkResponse[0].Ref).To(Equal(pipelineExecutions[1]["id"].(string)))
+				})
+			})
+
 			Context("when pipeline executions does not have the status we are looking for", func() {
 				BeforeEach(func() {
 					statuses = []string{"FAILED"}
@@ -263,7 +1050,7 @@ var _ = Describe("Check", func() {
 					statusCode = 200
 
 					allHandler = ghttp.CombineHandlers(
-						ghttp.VerifyRequest("GET", MatchRegexp(".*/applications/"+applicationName+"/pipelines"), "limit=25"),
+						ghttp.VerifyRequest("GET", "/applications/"+applicationName+"/executions/search", "startIndex=0&size=25&pipelineName="+pipelineName),
 						ghttp.RespondWithJSONEncoded(
 							statusCode,
 							[]map[string]interface{}{
@@ -11,6 +11,7 @@ package integration_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -40,6 +42,9 @@ var _ = Describe("In", func() {
 		allHandler                    http.HandlerFunc
 		inSess                        *gexec.Session
 		dir                           string
+		inParams                      concourse.InParams
+		spinnakerUI                   string
+		statusCheckInterval           string
 	)
 
 	JustBeforeEach(func() {
@@ -57,14 +62,6 @@ var _ = Describe("In", func() {
 						"name":     applicationName,
 					},
 				)),
-			ghttp.CombineHandlers(
-				ghttp.VerifyRequest("GET", MatchRegexp(".*/applications/"+applicationName+"/pipelineConfigs")),
-				ghttp.RespondWithJSONEncoded(
-					200,
-					[]map[string]string{
-						{"name": pipelineName},
-					},
-				)),
 			allHandler,
 		)
 		input = concourse.InRequest{
@@ -72,12 +69,15 @@ var _ = Describe("In", func() {
 				SpinnakerAPI:         spinnakerServer.URL(),
 				SpinnakerApplication: applicationName,
 				SpinnakerPipeline:    pipelineName,
+				SpinnakerUI:          spinnakerUI,
+				StatusCheckInterval:  statusCheckInterval,
 				X509Cert:             serverCert,
 				X509Key:              serverKey,
 			},
 			Version: concourse.Version{
 				Ref: pipelineID,
 			},
+			Params: inParams,
 		}
 
 		marshalledInput, err = json.Marshal(input)
@@ -138,6 +138,44 @@ var _ = Describe("In", func() {
 			Expect(string(actualVersionBytes)).To(Equal(pipelineID))
 		})
 
+		It("doesn't store canary results for executions without canary analysis", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+			Expect(filepath.Join(dir, "canary")).ToNot(BeADirectory())
+		})
+
+		It("stores each stage into its own JSON file", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			stages := mappedRes["stages"].([]interface{})
+			for i, name := range []string{"0-Check-precondition-expression-.json", "1-Check-Preconditions.json"} {
+				stageBytes, err := ioutil.ReadFile(filepath.Join(dir, "stages", name))
+				Expect(err).ToNot(HaveOccurred())
+
+				var stage map[string]interface{}
+				err = json.Unmarshal(stageBytes, &stage)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stage).To(Equal(stages[i]))
+			}
+		})
+
+		It("stores the trigger of the execution into its own JSON file", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			triggerBytes, err := ioutil.ReadFile(filepath.Join(dir, "trigger.json"))
+			Expect(err).ToNot(HaveOccurred())
+
+			var trigger map[string]interface{}
+			err = json.Unmarshal(triggerBytes, &trigger)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(trigger).To(Equal(mappedRes["trigger"]))
+		})
+
 		It("returns the version and concourse metadata to stdout", func() {
 			defer os.RemoveAll(dir)
 
@@ -165,6 +203,14 @@ var _ = Describe("In", func() {
 					Name:  "End time",
 					Value: time.Unix(1543414041439/1000, 0).Format(time.UnixDate),
 				},
+				concourse.InResponseMetadata{
+					Name:  "Duration",
+					Value: "75ms",
+				},
+				concourse.InResponseMetadata{
+					Name:  "Triggered by",
+					Value: "some-user",
+				},
 			}
 
 			var inResponse concourse.InResponse
@@ -180,6 +226,1271 @@ var _ = Describe("In", func() {
 		})
 	})
 
+	Context("when stages of the execution failed", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":        pipelineID,
+					"name":      pipelineName,
+					"status":    "TERMINAL",
+					"startTime": 1543414041000,
+					"endTime":   1543414161000,
+					"stages": []map[string]interface{}{
+						{"name": "Deploy", "status": "SUCCEEDED"},
+						{"name": "Smoke test", "status": "FAILED_CONTINUE"},
+						{"name": "Promote", "status": "TERMINAL"},
+					},
+				}),
+			)
+		})
+
+		It("names them in the metadata", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			var inResponse concourse.InResponse
+			err = json.Unmarshal(inSess.Out.Contents(), &inResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inResponse.Metadata).To(ContainElement(concourse.InResponseMetadata{Name: "Duration", Value: "2m0s"}))
+			Expect(inResponse.Metadata).To(ContainElement(concourse.InResponseMetadata{Name: "Failed stages", Value: "Smoke test, Promote"}))
+		})
+	})
+
+	Context("when waiting for the execution to complete", func() {
+		var statusPolls int
+
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			statusCheckInterval = "10ms"
+			inParams = concourse.InParams{Wait: true, WaitTimeout: "5s"}
+			statusPolls = 0
+
+			spinnakerServer.RouteToHandler("GET", "/pipelines/"+pipelineID, func(w http.ResponseWriter, r *http.Request) {
+				statusPolls++
+				status := "RUNNING"
+				if statusPolls == 3 {
+					status = "SUCCEEDED"
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"id": pipelineID, "name": pipelineName, "status": status})
+			})
+		})
+
+		AfterEach(func() {
+			statusCheckInterval = ""
+			inParams = concourse.InParams{}
+		})
+
+		It("polls the execution until it ended", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+			Expect(statusPolls).To(Equal(3))
+
+			metadata, err := ioutil.ReadFile(filepath.Join(dir, "metadata.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metadata).To(MatchJSON(`{"id": "goodID", "name": "` + pipelineName + `", "status": "SUCCEEDED"}`))
+		})
+
+		Context("when the execution doesn't end in time", func() {
+			BeforeEach(func() {
+				inParams.WaitTimeout = "50ms"
+				spinnakerServer.RouteToHandler("GET", "/pipelines/"+pipelineID, ghttp.RespondWithJSONEncoded(200, map[string]interface{}{"id": pipelineID, "status": "RUNNING"}))
+			})
+
+			It("fails", func() {
+				defer os.RemoveAll(dir)
+
+				Expect(inSess.ExitCode()).To(Equal(1))
+				Expect(inSess.Err).To(gbytes.Say("timed out waiting for the execution to complete"))
+			})
+		})
+	})
+
+	Context("when the job logs are requested", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{Logs: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":          pipelineID,
+					"name":        pipelineName,
+					"application": applicationName,
+					"stages": []map[string]interface{}{
+						{"name": "Migrate DB", "type": "runJob", "context": map[string]interface{}{
+							"cloudProvider": "kubernetes",
+							"account":       "k8s-prod",
+							"jobStatus": map[string]interface{}{
+								"location": "web",
+								"pods":     []map[string]interface{}{{"name": "migrate-x7k2p"}},
+							},
+						}},
+						{"name": "Build", "type": "script", "context": map[string]interface{}{}},
+					},
+				}),
+			)
+			spinnakerServer.RouteToHandler("GET", "/applications/"+applicationName+"/kubernetes/pods/k8s-prod/web/migrate-x7k2p/logs", ghttp.RespondWith(200, "migrated 3 tables\n"))
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the logs of the Run Job stages", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			logs, err := ioutil.ReadFile(filepath.Join(dir, "logs", "0-Migrate-DB.log"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(logs)).To(Equal("migrated 3 tables\n"))
+			Expect(inSess.Err).To(gbytes.Say("Skipping the logs of script stage Build"))
+		})
+	})
+
+	Context("when the child executions are requested", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{Children: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":   pipelineID,
+					"name": pipelineName,
+					"stages": []map[string]interface{}{
+						{"name": "Deploy services", "type": "pipeline", "context": map[string]interface{}{"executionId": "CHILD"}},
+					},
+				}),
+			)
+			spinnakerServer.RouteToHandler("GET", "/pipelines/CHILD", ghttp.RespondWithJSONEncoded(200, map[string]interface{}{
+				"id": "CHILD",
+				"stages": []map[string]interface{}{
+					{"name": "Deploy web", "type": "pipeline", "context": map[string]interface{}{"executionId": "GRANDCHILD"}},
+					{"name": "Loop back", "type": "pipeline", "context": map[string]interface{}{"executionId": pipelineID}},
+				},
+			}))
+			spinnakerServer.RouteToHandler("GET", "/pipelines/GRANDCHILD", ghttp.RespondWithJSONEncoded(200, map[string]interface{}{
+				"id": "GRANDCHILD",
+			}))
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the tree of child executions", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			child, err := ioutil.ReadFile(filepath.Join(dir, "children", "0-Deploy-services", "metadata.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(child)).To(ContainSubstring(`"id":"CHILD"`))
+
+			grandchild, err := ioutil.ReadFile(filepath.Join(dir, "children", "0-Deploy-services", "children", "0-Deploy-web", "metadata.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(grandchild).To(MatchJSON(`{"id": "GRANDCHILD"}`))
+
+			Expect(filepath.Join(dir, "children", "0-Deploy-services", "children", "1-Loop-back")).ToNot(BeADirectory())
+		})
+	})
+
+	Context("when values are extracted", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{Extract: map[string]string{
+				"deployed":   "$.stages[?(@.name=='Deploy')].outputs.deployedArtifacts",
+				"status":     "$.status",
+				"first-type": "$['stages'][0].type",
+				"regions":    "$..region",
+			}}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":     pipelineID,
+					"name":   pipelineName,
+					"status": "SUCCEEDED",
+					"stages": []map[string]interface{}{
+						{"name": "Bake", "type": "bake", "context": map[string]interface{}{"region": "us-east-1"}},
+						{"name": "Deploy", "type": "deploy", "context": map[string]interface{}{"region": "eu-west-1"}, "outputs": map[string]interface{}{
+							"deployedArtifacts": []string{"web:v1"},
+						}},
+					},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the result of each expression into its own file", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			deployed, err := ioutil.ReadFile(filepath.Join(dir, "extract", "deployed"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deployed).To(MatchJSON(`[["web:v1"]]`))
+
+			status, err := ioutil.ReadFile(filepath.Join(dir, "extract", "status"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(status)).To(Equal("SUCCEEDED"))
+
+			firstType, err := ioutil.ReadFile(filepath.Join(dir, "extract", "first-type"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(firstType)).To(Equal("bake"))
+
+			regions, err := ioutil.ReadFile(filepath.Join(dir, "extract", "regions"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(regions).To(MatchJSON(`["us-east-1", "eu-west-1"]`))
+		})
+
+		Context("when an expression points to nothing", func() {
+			BeforeEach(func() {
+				inParams.Extract = map[string]string{"missing": "$.trigger.user"}
+			})
+
+			It("fails", func() {
+				defer os.RemoveAll(dir)
+
+				Expect(inSess.ExitCode()).To(Equal(1))
+				Expect(inSess.Err).To(gbytes.Say(`extract missing: \$.trigger.user matched nothing`))
+			})
+		})
+
+		Context("when an expression is invalid", func() {
+			BeforeEach(func() {
+				inParams.Extract = map[string]string{"invalid": "$.stages[0"}
+			})
+
+			It("fails", func() {
+				defer os.RemoveAll(dir)
+
+				Expect(inSess.ExitCode()).To(Equal(1))
+				Expect(inSess.Err).To(gbytes.Say(`extract invalid: parsing error: \$.stages\[0`))
+			})
+		})
+	})
+
+	Context("when a junit report is requested", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{JUnit: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":          pipelineID,
+					"name":        pipelineName,
+					"application": applicationName,
+					"status":      "TERMINAL",
+					"startTime":   1543414041000,
+					"endTime":     1543414101500,
+					"stages": []map[string]interface{}{
+						{"name": "Deploy", "status": "SUCCEEDED", "startTime": 1543414041000, "endTime": 1543414071250},
+						{"name": "Smoke test", "status": "TERMINAL", "startTime": 1543414071250, "endTime": 1543414101500, "context": map[string]interface{}{
+							"exception": map[string]interface{}{"details": map[string]interface{}{"errors": []string{"health check failed", "3 of 3 pods unready"}}},
+						}},
+						{"name": "Promote", "status": "NOT_STARTED"},
+					},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("reports each stage as a test case", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			report, err := ioutil.ReadFile(filepath.Join(dir, "junit.xml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(report)).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<testsuite name="` + applicationName + `.` + pipelineName + `" tests="3" failures="1" skipped="1" time="60.500">
+  <testcase name="Deploy" classname="` + applicationName + `.` + pipelineName + `" time="30.250"></testcase>
+  <testcase name="Smoke test" classname="` + applicationName + `.` + pipelineName + `" time="30.250">
+    <failure message="health check failed" type="TERMINAL">health check failed&#xA;3 of 3 pods unready</failure>
+  </testcase>
+  <testcase name="Promote" classname="` + applicationName + `.` + pipelineName + `" time="0.000">
+    <skipped></skipped>
+  </testcase>
+</testsuite>`))
+		})
+	})
+
+	Context("when custom stages report errors of another shape", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{JUnit: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":          pipelineID,
+					"name":        pipelineName,
+					"application": applicationName,
+					"status":      "TERMINAL",
+					"stages": []interface{}{
+						map[string]interface{}{"name": "Resize", "status": "TERMINAL", "context": map[string]interface{}{
+							"exception": map[string]interface{}{"details": map[string]interface{}{"errors": []interface{}{map[string]string{"message": "quota exceeded"}}}},
+						}},
+						map[string]interface{}{"name": "Custom", "status": "TERMINAL", "context": map[string]interface{}{
+							"exception": map[string]interface{}{"details": map[string]interface{}{"error": map[string]string{"code": "E42"}}},
+						}},
+					},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("still writes the reports, formatting the errors", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			report, err := ioutil.ReadFile(filepath.Join(dir, "junit.xml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(report)).To(ContainSubstring(`<failure message="{&#34;message&#34;:&#34;quota exceeded&#34;}" type="TERMINAL">`))
+			Expect(string(report)).To(ContainSubstring(`<failure message="{&#34;code&#34;:&#34;E42&#34;}" type="TERMINAL">`))
+			Expect(filepath.Join(dir, "summary.md")).To(BeAnExistingFile())
+		})
+	})
+
+	Context("when the summary is written", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":          pipelineID,
+					"name":        pipelineName,
+					"application": applicationName,
+					"status":      "SUCCEEDED",
+					"startTime":   1543414041000,
+					"endTime":     1543414101000,
+					"trigger":     map[string]interface{}{"parameters": map[string]interface{}{"version": "1.2.3", "targets": "a|b"}},
+					"stages": []map[string]interface{}{
+						{"name": "Deploy", "type": "deploy", "status": "SUCCEEDED", "startTime": 1543414041000, "endTime": 1543414071250},
+						{"name": "Promote", "type": "manualJudgment", "status": "SKIPPED"},
+					},
+				}),
+			)
+		})
+
+		It("summarizes the execution in markdown", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			summary, err := ioutil.ReadFile(filepath.Join(dir, "summary.md"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(summary)).To(Equal("# " + applicationName + "/" + pipelineName + "\n\n" +
+				"**Status:** SUCCEEDED  \n" +
+				"**Duration:** 1m0s  \n" +
+				"**Execution:** goodID\n" +
+				"\n## Parameters\n\n| Name | Value |\n| --- | --- |\n" +
+				"| targets | a\\|b |\n" +
+				"| version | 1.2.3 |\n" +
+				"\n## Stages\n\n| Stage | Type | Status | Duration |\n| --- | --- | --- | --- |\n" +
+				"| Deploy | deploy | SUCCEEDED | 30.25s |\n" +
+				"| Promote | manualJudgment | SKIPPED | - |\n"))
+		})
+	})
+
+	Context("when a timeline is requested", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{Timeline: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":   pipelineID,
+					"name": pipelineName,
+					"stages": []map[string]interface{}{
+						{"name": "Deploy, then verify", "type": "deploy", "status": "SUCCEEDED", "startTime": 1543414041000, "endTime": 1543414071250},
+						{"name": "Promote", "type": "manualJudgment", "status": "RUNNING", "startTime": 1543414071250},
+					},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the timeline of the stages as CSV and JSON", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			timeline, err := ioutil.ReadFile(filepath.Join(dir, "timeline.csv"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(timeline)).To(Equal("execution,pipeline,stage,type,status,start_time,end_time,duration_seconds\n" +
+				"goodID," + pipelineName + ",\"Deploy, then verify\",deploy,SUCCEEDED,2018-11-28T14:07:21Z,2018-11-28T14:07:51.25Z,30.250\n" +
+				"goodID," + pipelineName + ",Promote,manualJudgment,RUNNING,2018-11-28T14:07:51.25Z,,0.000\n"))
+
+			timelineJSON, err := ioutil.ReadFile(filepath.Join(dir, "timeline.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(timelineJSON).To(MatchJSON(`[
+				{"execution": "goodID", "pipeline": "` + pipelineName + `", "stage": "Deploy, then verify", "type": "deploy", "status": "SUCCEEDED", "startTime": "2018-11-28T14:07:21Z", "endTime": "2018-11-28T14:07:51.25Z", "durationSeconds": 30.25},
+				{"execution": "goodID", "pipeline": "` + pipelineName + `", "stage": "Promote", "type": "manualJudgment", "status": "RUNNING", "startTime": "2018-11-28T14:07:51.25Z", "endTime": "", "durationSeconds": 0}
+			]`))
+		})
+	})
+
+	Context("when the evaluated variables are requested", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{Variables: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":   pipelineID,
+					"name": pipelineName,
+					"stages": []map[string]interface{}{
+						{"name": "Compute version", "type": "evaluateVariables", "outputs": map[string]interface{}{"version": "1.2.3", "endpoint": "https://old.example.com"}},
+						{"name": "Deploy", "type": "deploy", "outputs": map[string]interface{}{"ignored": true}},
+						{"name": "Compute endpoint", "type": "evaluateVariables", "outputs": map[string]interface{}{"endpoint": "https://web.example.com"}},
+					},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the variables as JSON and shell exports", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			variables, err := ioutil.ReadFile(filepath.Join(dir, "variables.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(variables).To(MatchJSON(`{"version": "1.2.3", "endpoint": "https://web.example.com"}`))
+
+			env, err := ioutil.ReadFile(filepath.Join(dir, "variables.env"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(env)).To(Equal("export endpoint='https://web.example.com'\nexport version='1.2.3'\n"))
+		})
+	})
+
+	Context("when the source names the application and pipeline", func() {
+		var executionApplication, executionPipeline string
+
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			applicationName = "some-application"
+			pipelineName = "some-pipeline"
+		})
+
+		AfterEach(func() {
+			applicationName = ""
+			pipelineName = ""
+		})
+
+		setExecution := func() {
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":          pipelineID,
+					"application": executionApplication,
+					"name":        executionPipeline,
+				}),
+			)
+		}
+
+		Context("and the execution belongs to them", func() {
+			BeforeEach(func() {
+				executionApplication = "some-application"
+				executionPipeline = "some-pipeline"
+				setExecution()
+			})
+
+			It("fetches the execution", func() {
+				defer os.RemoveAll(dir)
+
+				Expect(inSess.ExitCode()).To(Equal(0))
+				Expect(filepath.Join(dir, "metadata.json")).To(BeAnExistingFile())
+			})
+		})
+
+		Context("and the execution belongs to another application", func() {
+			BeforeEach(func() {
+				executionApplication = "other-application"
+				executionPipeline = "some-pipeline"
+				setExecution()
+			})
+
+			It("fails without writing the execution", func() {
+				defer os.RemoveAll(dir)
+
+				Expect(inSess.ExitCode()).To(Equal(1))
+				Expect(inSess.Err).To(gbytes.Say("execution goodID belongs to application other-application, which is not configured in the source"))
+				Expect(filepath.Join(dir, "metadata.json")).ToNot(BeAnExistingFile())
+			})
+		})
+
+		Context("and the execution belongs to another pipeline", func() {
+			BeforeEach(func() {
+				executionApplication = "some-application"
+				executionPipeline = "other-pipeline"
+				setExecution()
+			})
+
+			It("fails without writing the execution", func() {
+				defer os.RemoveAll(dir)
+
+				Expect(inSess.ExitCode()).To(Equal(1))
+				Expect(inSess.Err).To(gbytes.Say("execution goodID belongs to pipeline other-pipeline, which is not configured in the source"))
+				Expect(filepath.Join(dir, "metadata.json")).ToNot(BeAnExistingFile())
+			})
+		})
+	})
+
+	Context("when the execution is looked up by its eventId", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "EX1"
+			applicationName = "some-application"
+			pipelineName = "some-pipeline"
+			inParams = concourse.InParams{EventID: "change-42"}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/some-application/executions/search", "startIndex=0&size=25&pipelineName=some-pipeline&eventId=change-42"),
+				ghttp.RespondWithJSONEncoded(statusCode, []map[string]interface{}{{"id": "EX9"}}),
+			)
+			spinnakerServer.RouteToHandler("GET", "/pipelines/EX9", ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+				"id":          "EX9",
+				"application": applicationName,
+				"name":        pipelineName,
+			}))
+		})
+
+		AfterEach(func() {
+			applicationName = ""
+			pipelineName = ""
+			inParams = concourse.InParams{}
+		})
+
+		It("fetches the execution triggered with it and emits the version asked for", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			version, err := ioutil.ReadFile(filepath.Join(dir, "version"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(version)).To(Equal("EX9"))
+
+			var response concourse.InResponse
+			Expect(json.Unmarshal(inSess.Out.Contents(), &response)).To(Succeed())
+			Expect(response.Version).To(Equal(concourse.Version{Ref: "EX1"}))
+		})
+	})
+
+	Context("when the stage contexts are trimmed", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{MaxContextSize: 100, RedactContextKeys: []string{"password"}}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWith(statusCode, `{
+					"id": "goodID",
+					"buildTime": 1534570691845,
+					"stages": [
+						{"name": "Bake", "context": {"account": "prod", "credentials": [{"user": "ci", "password": "hunter2"}]}},
+						{"name": "Deploy", "context": {"manifests": ["`+strings.Repeat("x", 200)+`"]}}
+					]
+				}`),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("redacts the keys and drops the oversized contexts from the written execution", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			metadata, err := ioutil.ReadFile(filepath.Join(dir, "metadata.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metadata).To(MatchJSON(`{
+				"id": "goodID",
+				"buildTime": 1534570691845,
+				"stages": [
+					{"name": "Bake", "context": {"account": "prod", "credentials": [{"user": "ci", "password": "**REDACTED**"}]}},
+					{"name": "Deploy", "context": {"trimmedContextSize": 218}}
+				]
+			}`))
+			Expect(string(metadata)).To(ContainSubstring(`"buildTime":1534570691845`))
+
+			stage, err := ioutil.ReadFile(filepath.Join(dir, "stages", "1-Deploy.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stage).To(MatchJSON(`{"name": "Deploy", "context": {"trimmedContextSize": 218}}`))
+		})
+	})
+
+	Context("when redacted keys appear in webhooks and outputs", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{RedactContextKeys: []string{"token"}, Webhooks: true, Outputs: true, Variables: true, JUnit: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWith(statusCode, `{
+					"id": "goodID",
+					"status": "SUCCEEDED",
+					"stages": [
+						{"name": "Notify", "type": "webhook", "status": "SUCCEEDED", "context": {
+							"method": "POST",
+							"url": "https://hooks.example.com",
+							"payload": {"token": "s3cr3t-payload"},
+							"webhook": {"statusCode": 200, "body": {"token": "s3cr3t-body"}}
+						}, "outputs": {"token": "s3cr3t-output", "release": "1.2.3"}}
+					]
+				}`),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("leaves them out of every file", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			outputs, err := ioutil.ReadFile(filepath.Join(dir, "outputs.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(outputs).To(MatchJSON(`{"token": "**REDACTED**", "release": "1.2.3"}`))
+
+			var files int
+			err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				files++
+				contents, err := ioutil.ReadFile(path)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).ToNot(ContainSubstring("s3cr3t"), path)
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(BeNumerically(">", 5))
+		})
+	})
+
+	Context("when a json format is configured", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWith(statusCode, `{"status": "SUCCEEDED", "id": "goodID", "buildTime": 1534570691845, "stages": [{"name": "Deploy", "id": "01"}]}`),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		Context("to indent", func() {
+			BeforeEach(func() {
+				inParams = concourse.InParams{JSONFormat: "indent"}
+			})
+
+			It("writes the JSON files indented, with sorted keys", func() {
+				defer os.RemoveAll(dir)
+
+				Expect(inSess.ExitCode()).To(Equal(0))
+
+				metadata, err := ioutil.ReadFile(filepath.Join(dir, "metadata.json"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(metadata)).To(Equal(`{
+  "buildTime": 1534570691845,
+  "id": "goodID",
+  "stages": [
+    {
+      "id": "01",
+      "name": "Deploy"
+    }
+  ],
+  "status": "SUCCEEDED"
+}`))
+
+				stage, err := ioutil.ReadFile(filepath.Join(dir, "stages", "0-Deploy.json"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(stage)).To(Equal("{\n  \"id\": \"01\",\n  \"name\": \"Deploy\"\n}"))
+			})
+		})
+
+		Context("to compact", func() {
+			BeforeEach(func() {
+				inParams = concourse.InParams{JSONFormat: "compact"}
+			})
+
+			It("writes the JSON files compacted, with sorted keys", func() {
+				defer os.RemoveAll(dir)
+
+				Expect(inSess.ExitCode()).To(Equal(0))
+
+				metadata, err := ioutil.ReadFile(filepath.Join(dir, "metadata.json"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(metadata)).To(Equal(`{"buildTime":1534570691845,"id":"goodID","stages":[{"id":"01","name":"Deploy"}],"status":"SUCCEEDED"}`))
+			})
+		})
+
+		Context("that is unknown", func() {
+			BeforeEach(func() {
+				inParams = concourse.InParams{JSONFormat: "pretty"}
+			})
+
+			It("fails", func() {
+				defer os.RemoveAll(dir)
+
+				Expect(inSess.ExitCode()).To(Equal(1))
+				Expect(inSess.Err).To(gbytes.Say("invalid json_format: pretty, must be indent or compact"))
+			})
+		})
+	})
+
+	Context("when the execution is compressed", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{Compress: "gzip"}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWith(statusCode, `{"id": "goodID", "status": "SUCCEEDED", "stages": [{"name": "Deploy", "status": "SUCCEEDED"}]}`),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		readGzip := func(path string) []byte {
+			file, err := os.Open(path)
+			Expect(err).ToNot(HaveOccurred())
+			defer file.Close()
+			reader, err := gzip.NewReader(file)
+			Expect(err).ToNot(HaveOccurred())
+			contents, err := ioutil.ReadAll(reader)
+			Expect(err).ToNot(HaveOccurred())
+			return contents
+		}
+
+		It("writes the execution documents gzipped", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			Expect(filepath.Join(dir, "metadata.json")).ToNot(BeAnExistingFile())
+			Expect(readGzip(filepath.Join(dir, "metadata.json.gz"))).To(MatchJSON(`{"id": "goodID", "status": "SUCCEEDED", "stages": [{"name": "Deploy", "status": "SUCCEEDED"}]}`))
+			Expect(readGzip(filepath.Join(dir, "stages", "0-Deploy.json.gz"))).To(MatchJSON(`{"name": "Deploy", "status": "SUCCEEDED"}`))
+			Expect(filepath.Join(dir, "summary.md")).To(BeAnExistingFile())
+		})
+	})
+
+	Context("when the entity tags are requested", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{EntityTags: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id": pipelineID,
+					"stages": []map[string]interface{}{
+						{"name": "Deploy", "type": "deploy", "context": map[string]interface{}{
+							"account":              "prod",
+							"deploy.server.groups": map[string]interface{}{"us-east-1": []string{"web-v002"}},
+						}},
+					},
+				}),
+			)
+			spinnakerServer.RouteToHandler("GET", "/tags", ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/tags", "account=prod&entityId=web-v002&entityType=servergroup&region=us-east-1"),
+				ghttp.RespondWith(statusCode, `[{"id": "aws:servergroup:web-v002:prod:us-east-1", "tags": [{"name": "owner", "value": "team-web"}]}]`),
+			))
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the entity tags of the deployed server groups", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			tags, err := ioutil.ReadFile(filepath.Join(dir, "entity_tags.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags).To(MatchJSON(`[{
+				"stage": "Deploy",
+				"account": "prod",
+				"region": "us-east-1",
+				"name": "web-v002",
+				"entityTags": [{"id": "aws:servergroup:web-v002:prod:us-east-1", "tags": [{"name": "owner", "value": "team-web"}]}]
+			}]`))
+		})
+	})
+
+	Context("when the webhook exchanges are requested", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{Webhooks: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":   pipelineID,
+					"name": pipelineName,
+					"stages": []map[string]interface{}{
+						{"name": "Deploy", "type": "deploy"},
+						{"name": "Open change", "type": "webhook", "context": map[string]interface{}{
+							"method":  "POST",
+							"url":     "https://change.example.com/api/changes",
+							"payload": map[string]interface{}{"service": "web"},
+							"webhook": map[string]interface{}{"statusCode": "CREATED", "body": map[string]interface{}{"ticket": "CHG0042"}},
+						}},
+					},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the request and response of each webhook stage", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			exchange, err := ioutil.ReadFile(filepath.Join(dir, "webhooks", "1-Open-change.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exchange).To(MatchJSON(`{
+				"stage": "Open change",
+				"method": "POST",
+				"url": "https://change.example.com/api/changes",
+				"payload": {"service": "web"},
+				"statusCode": "CREATED",
+				"response": {"ticket": "CHG0042"}
+			}`))
+			Expect(filepath.Join(dir, "webhooks", "0-Deploy.json")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Context("when the spinnaker ui is configured", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			spinnakerUI = "https://spinnaker.example.com"
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":          pipelineID,
+					"name":        pipelineName,
+					"application": applicationName,
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			spinnakerUI = ""
+		})
+
+		It("stores a link to the execution in a url file and in the metadata", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			link := "https://spinnaker.example.com/#/applications/" + applicationName + "/executions/details/" + pipelineID
+			url, err := ioutil.ReadFile(filepath.Join(dir, "url"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(url)).To(Equal(link))
+
+			var inResponse concourse.InResponse
+			err = json.Unmarshal(inSess.Out.Contents(), &inResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inResponse.Metadata).To(ContainElement(concourse.InResponseMetadata{Name: "URL", Value: link}))
+		})
+	})
+
+	Context("when the execution was triggered with parameters", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":   pipelineID,
+					"name": pipelineName,
+					"trigger": map[string]interface{}{
+						"parameters": map[string]interface{}{
+							"version":      "1.2.3",
+							"release-note": "it's out",
+							"replicas":     3,
+						},
+					},
+				}),
+			)
+		})
+
+		It("stores each parameter into its own file, and all of them as shell exports", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			version, err := ioutil.ReadFile(filepath.Join(dir, "params", "version"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(version)).To(Equal("1.2.3"))
+
+			replicas, err := ioutil.ReadFile(filepath.Join(dir, "params", "replicas"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(replicas)).To(Equal("3"))
+
+			env, err := ioutil.ReadFile(filepath.Join(dir, "params.env"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(env)).To(Equal("export release_note='it'\\''s out'\nexport replicas='3'\nexport version='1.2.3'\n"))
+		})
+	})
+
+	Context("when the download is skipped", func() {
+		BeforeEach(func() {
+			pipelineID = "goodID"
+			inParams = concourse.InParams{SkipDownload: true}
+			allHandler = ghttp.RespondWith(500, "")
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("only stores the version, without calling Spinnaker", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+			Expect(spinnakerServer.ReceivedRequests()).To(BeEmpty())
+
+			version, err := ioutil.ReadFile(filepath.Join(dir, "version"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(version)).To(Equal(pipelineID))
+			Expect(filepath.Join(dir, "metadata.json")).ToNot(BeAnExistingFile())
+
+			var inResponse concourse.InResponse
+			err = json.Unmarshal(inSess.Out.Contents(), &inResponse)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inResponse.Version).To(Equal(concourse.Version{Ref: pipelineID}))
+		})
+	})
+
+	Context("when getting the version of a dry run", func() {
+		BeforeEach(func() {
+			pipelineID = concourse.DryRunRef
+			allHandler = ghttp.RespondWith(500, "")
+		})
+
+		It("only stores the version and a dry_run marker, without calling Spinnaker", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+			Expect(spinnakerServer.ReceivedRequests()).To(BeEmpty())
+
+			version, err := ioutil.ReadFile(filepath.Join(dir, "version"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(version)).To(Equal(concourse.DryRunRef))
+			dryRun, err := ioutil.ReadFile(filepath.Join(dir, "dry_run"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(dryRun)).To(Equal("true"))
+			Expect(filepath.Join(dir, "metadata.json")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Context("when the stage outputs are requested", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{Outputs: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":   pipelineID,
+					"name": pipelineName,
+					"stages": []map[string]interface{}{
+						{"name": "Bake", "outputs": map[string]interface{}{"imageId": "ami-1", "region": "us-east-1"}},
+						{"name": "Wait", "outputs": map[string]interface{}{}},
+						{"name": "Deploy", "outputs": map[string]interface{}{"region": "eu-west-1"}},
+					},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the outputs of each stage, and all of them merged", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			bakeBytes, err := ioutil.ReadFile(filepath.Join(dir, "outputs", "0-Bake.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bakeBytes).To(MatchJSON(`{"imageId": "ami-1", "region": "us-east-1"}`))
+			Expect(filepath.Join(dir, "outputs", "1-Wait.json")).ToNot(BeAnExistingFile())
+
+			mergedBytes, err := ioutil.ReadFile(filepath.Join(dir, "outputs.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mergedBytes).To(MatchJSON(`{"imageId": "ami-1", "region": "eu-west-1"}`))
+		})
+	})
+
+	Context("when the artifacts are downloaded", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{DownloadArtifacts: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":   pipelineID,
+					"name": pipelineName,
+					"stages": []map[string]interface{}{
+						{"name": "Bake", "outputs": map[string]interface{}{"artifacts": []map[string]interface{}{
+							{"type": "docker/image", "name": "gcr.io/acme/web", "reference": "gcr.io/acme/web:v1"},
+							{"type": "http/file", "name": "https://example.com/manifests/web.yml", "reference": "https://example.com/manifests/web.yml", "artifactAccount": "http"},
+						}}},
+						{"name": "Render", "outputs": map[string]interface{}{"artifacts": []map[string]interface{}{
+							{"type": "embedded/base64", "name": "values.yml", "reference": "cmVwbGljYXM6IDMK"},
+						}}},
+					},
+				}),
+			)
+			spinnakerServer.RouteToHandler("PUT", "/artifacts/fetch/", ghttp.CombineHandlers(
+				ghttp.VerifyJSON(`{"type": "http/file", "name": "https://example.com/manifests/web.yml", "reference": "https://example.com/manifests/web.yml", "artifactAccount": "http"}`),
+				ghttp.RespondWith(200, "kind: Deployment\n"),
+			))
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the contents of the artifacts the stages produced", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			manifest, err := ioutil.ReadFile(filepath.Join(dir, "artifacts", "1-web.yml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(manifest)).To(Equal("kind: Deployment\n"))
+
+			values, err := ioutil.ReadFile(filepath.Join(dir, "artifacts", "2-values.yml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(values)).To(Equal("replicas: 3\n"))
+
+			Expect(filepath.Join(dir, "artifacts", "0-web")).ToNot(BeAnExistingFile())
+
+			var listed []map[string]interface{}
+			listBytes, err := ioutil.ReadFile(filepath.Join(dir, "artifacts.json"))
+			Expect(err).ToNot(HaveOccurred())
+			err = json.Unmarshal(listBytes, &listed)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(listed).To(HaveLen(3))
+		})
+	})
+
+	Context("when the baked images are requested", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{Images: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":   pipelineID,
+					"name": pipelineName,
+					"stages": []map[string]interface{}{
+						{"name": "Bake", "type": "bake", "context": map[string]interface{}{"cloudProviderType": "aws", "region": "us-east-1", "ami": "ami-0a1b", "imageName": "web-1.0"}},
+						{"name": "Bake in us-east-1", "type": "bake", "context": map[string]interface{}{"cloudProviderType": "aws", "region": "us-east-1", "ami": "ami-0a1b", "imageName": "web-1.0"}},
+						{"name": "Bake GCE", "type": "bake", "context": map[string]interface{}{"cloudProvider": "gce", "imageId": "web-1-0-gce", "imageName": "web-1-0-gce"}},
+						{"name": "Deploy", "type": "deploy", "context": map[string]interface{}{"imageId": "ignored"}},
+					},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the images the bake stages produced", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			imagesBytes, err := ioutil.ReadFile(filepath.Join(dir, "images.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(imagesBytes).To(MatchJSON(`[
+				{"stage": "Bake", "cloudProvider": "aws", "region": "us-east-1", "imageId": "ami-0a1b", "imageName": "web-1.0"},
+				{"stage": "Bake GCE", "cloudProvider": "gce", "imageId": "web-1-0-gce", "imageName": "web-1-0-gce"}
+			]`))
+
+			ids, err := ioutil.ReadFile(filepath.Join(dir, "images.txt"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(ids)).To(Equal("ami-0a1b\nweb-1-0-gce\n"))
+		})
+	})
+
+	Context("when the deployments are requested", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+			inParams = concourse.InParams{Deployments: true}
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":   pipelineID,
+					"name": pipelineName,
+					"stages": []map[string]interface{}{
+						{"name": "Deploy", "type": "createServerGroup", "context": map[string]interface{}{
+							"account":              "prod",
+							"cloudProvider":        "aws",
+							"deploy.server.groups": map[string]interface{}{"us-west-2": []string{"web-v004"}, "us-east-1": []string{"web-v003"}},
+						}},
+						{"name": "Deploy (Manifest)", "type": "deployManifest", "outputs": map[string]interface{}{
+							"outputs.manifests": []map[string]interface{}{
+								{"kind": "Deployment", "metadata": map[string]interface{}{"name": "web", "namespace": "prod"}},
+							},
+						}},
+					},
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			inParams = concourse.InParams{}
+		})
+
+		It("stores the server groups and manifests the stages deployed", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			serverGroups, err := ioutil.ReadFile(filepath.Join(dir, "server_groups.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serverGroups).To(MatchJSON(`[
+				{"stage": "Deploy", "account": "prod", "cloudProvider": "aws", "region": "us-east-1", "name": "web-v003"},
+				{"stage": "Deploy", "account": "prod", "cloudProvider": "aws", "region": "us-west-2", "name": "web-v004"}
+			]`))
+
+			manifest, err := ioutil.ReadFile(filepath.Join(dir, "manifests", "0-Deployment-web.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifest).To(MatchJSON(`{"kind": "Deployment", "metadata": {"name": "web", "namespace": "prod"}}`))
+			Expect(filepath.Join(dir, "manifests.json")).To(BeAnExistingFile())
+		})
+	})
+
+	Context("when the execution ran a canary analysis", func() {
+		BeforeEach(func() {
+			statusCode = 200
+			pipelineID = "goodID"
+
+			allHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", MatchRegexp(".*/pipelines/"+pipelineID)),
+				ghttp.RespondWithJSONEncoded(statusCode, map[string]interface{}{
+					"id":   pipelineID,
+					"name": pipelineName,
+					"stages": []map[string]interface{}{
+						{"name": "Canary Analysis", "type": "kayentaCanary", "status": "SUCCEEDED", "context": map[string]interface{}{
+							"canaryScores":       []float64{92.5},
+							"canaryScoreMessage": "Final canary score 92.5 met or exceeded the pass score threshold.",
+						}},
+						{"name": "Run Canary #1", "type": "runCanary", "status": "SUCCEEDED", "context": map[string]interface{}{
+							"canaryPipelineExecutionId": "01CANARY",
+						}},
+					},
+				}),
+			)
+			spinnakerServer.RouteToHandler("GET", "/v2/canaries/canary/01CANARY", ghttp.RespondWith(200, `{"result": {"judgeResult": {"score": {"score": 92.5}}}}`))
+		})
+
+		It("stores the canary scores and judgments", func() {
+			defer os.RemoveAll(dir)
+
+			Expect(inSess.ExitCode()).To(Equal(0))
+
+			scores, err := ioutil.ReadFile(filepath.Join(dir, "canary", "scores.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scores).To(MatchJSON(`[{"stage": "Canary Analysis", "status": "SUCCEEDED", "scores": [92.5], "message": "Final canary score 92.5 met or exceeded the pass score threshold."}]`))
+
+			judgment, err := ioutil.ReadFile(filepath.Join(dir, "canary", "01CANARY.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(judgment).To(MatchJSON(`{"result": {"judgeResult": {"score": {"score": 92.5}}}}`))
+		})
+		Context("and Kayenta can't return the judgment", func() {
+			BeforeEach(func() {
+				spinnakerServer.RouteToHandler("GET", "/v2/canaries/canary/01CANARY", ghttp.RespondWith(500, "kayenta unavailable"))
+			})
+
+			It("still gets the execution, with a warning", func() {
+				defer os.RemoveAll(dir)
+
+				Expect(inSess.ExitCode()).To(Equal(0))
+				Expect(inSess.Err).To(gbytes.Say("Failed to fetch the judgment of canary 01CANARY"))
+				Expect(filepath.Join(dir, "metadata.json")).To(BeAnExistingFile())
+				Expect(filepath.Join(dir, "canary", "scores.json")).To(BeAnExistingFile())
+				Expect(filepath.Join(dir, "canary", "01CANARY.json")).ToNot(BeAnExistingFile())
+			})
+		})
+	})
+
 	Context("when spinnaker responds with status code > 400", func() {
 		Context("when the status code is not 404", func() {
 			BeforeEach(func() {
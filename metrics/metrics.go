@@ -0,0 +1,205 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package metrics
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/colorstring"
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+const (
+	defaultJob = "spinnaker_resource"
+	namespace  = "spinnaker_resource"
+)
+
+// latency buckets in seconds
+var apiLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+var (
+	mu             sync.Mutex
+	apiRequests    = map[string]uint64{}
+	apiLatency     = histogram{counts: make([]uint64, len(apiLatencyBuckets))}
+	triggers       uint64
+	pollIterations uint64
+	failures       uint64
+)
+
+// ObserveAPIRequest records a request to Gate by its response status code, or
+// "error" when no response was received
+func ObserveAPIRequest(code string, duration time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	apiRequests[code]++
+	seconds := duration.Seconds()
+	for i, bound := range apiLatencyBuckets {
+		if seconds <= bound {
+			apiLatency.counts[i]++
+		}
+	}
+	apiLatency.sum += seconds
+	apiLatency.count++
+}
+
+func IncTriggers() {
+	mu.Lock()
+	defer mu.Unlock()
+	triggers++
+}
+
+func IncPollIterations() {
+	mu.Lock()
+	defer mu.Unlock()
+	pollIterations++
+}
+
+func IncFailures() {
+	mu.Lock()
+	defer mu.Unlock()
+	failures++
+}
+
+// Setup pushes the metrics of this run to the configured Pushgateway with the
+// transport when the resource exits. Nothing is pushed when no
+// pushgateway_url is configured.
+func Setup(source concourse.Source, step string, transport http.RoundTripper) {
+	if source.PushgatewayURL == "" {
+		return
+	}
+	concourse.OnExit(func(failed bool) {
+		if failed {
+			IncFailures()
+		}
+		if err := Push(source, step, transport); err != nil {
+			concourse.Sayf(colorstring.Color("[yellow]WARNING: %s\n"), "pushing metrics failed: "+err.Error())
+		}
+	})
+}
+
+// Push replaces the metrics grouped under this step, application and pipeline
+// in the Pushgateway with the ones recorded during this run
+func Push(source concourse.Source, step string, transport http.RoundTripper) error {
+	job := source.MetricsJob
+	if job == "" {
+		job = defaultJob
+	}
+	pushURL := strings.TrimSuffix(source.PushgatewayURL, "/") + "/metrics" +
+		groupingPath("job", job) + groupingPath("step", step) +
+		groupingPath("application", applicationLabel(source)) + groupingPath("pipeline", pipelineLabel(source))
+
+	req, err := http.NewRequest("PUT", pushURL, bytes.NewBufferString(Expose()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("pushgateway responded with status code: %d", res.StatusCode)
+	}
+	return nil
+}
+
+// groupingPath returns the part of the push URL for a grouping label. Empty
+// values and ones with a /, which can't be path segments, are base64 encoded
+// the way the Pushgateway expects.
+func groupingPath(name, value string) string {
+	if value == "" {
+		return "/" + name + "@base64/="
+	}
+	if strings.Contains(value, "/") {
+		return "/" + name + "@base64/" + base64.URLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + name + "/" + url.PathEscape(value)
+}
+
+// Expose renders the metrics in the Prometheus text format. Every push
+// replaces the ones of the previous run, so they are gauges of the last run
+// rather than counters.
+func Expose() string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# HELP %s_last_run_api_requests Requests sent to Spinnaker in the last run by response status code.\n", namespace)
+	fmt.Fprintf(&b, "# TYPE %s_last_run_api_requests gauge\n", namespace)
+	codes := make([]string, 0, len(apiRequests))
+	for code := range apiRequests {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(&b, "%s_last_run_api_requests{code=%q} %d\n", namespace, code, apiRequests[code])
+	}
+
+	fmt.Fprintf(&b, "# HELP %s_last_run_api_requests_within_seconds Requests of the last run Spinnaker answered within le seconds.\n", namespace)
+	fmt.Fprintf(&b, "# TYPE %s_last_run_api_requests_within_seconds gauge\n", namespace)
+	for i, bound := range apiLatencyBuckets {
+		fmt.Fprintf(&b, "%s_last_run_api_requests_within_seconds{le=\"%g\"} %d\n", namespace, bound, apiLatency.counts[i])
+	}
+	fmt.Fprintf(&b, "%s_last_run_api_requests_within_seconds{le=\"+Inf\"} %d\n", namespace, apiLatency.count)
+	fmt.Fprintf(&b, "# HELP %s_last_run_api_request_duration_seconds Time the last run spent on requests to Spinnaker.\n", namespace)
+	fmt.Fprintf(&b, "# TYPE %s_last_run_api_request_duration_seconds gauge\n", namespace)
+	fmt.Fprintf(&b, "%s_last_run_api_request_duration_seconds %g\n", namespace, apiLatency.sum)
+
+	gauges := []struct {
+		name, help string
+		value      uint64
+	}{
+		{"last_run_triggers", "Pipeline executions the last run triggered.", triggers},
+		{"last_run_poll_iterations", "Times the last run polled the status of a triggered execution.", pollIterations},
+		{"last_run_failed", "Whether the last run failed.", failures},
+	}
+	for _, gauge := range gauges {
+		fmt.Fprintf(&b, "# HELP %s_%s %s\n", namespace, gauge.name, gauge.help)
+		fmt.Fprintf(&b, "# TYPE %s_%s gauge\n", namespace, gauge.name)
+		fmt.Fprintf(&b, "%s_%s %d\n", namespace, gauge.name, gauge.value)
+	}
+	return b.String()
+}
+
+func applicationLabel(source concourse.Source) string {
+	if applications := source.Applications(); len(applications) > 0 {
+		return strings.Join(applications, ",")
+	}
+	return source.SpinnakerAppRegex
+}
+
+func pipelineLabel(source concourse.Source) string {
+	if pipelines := source.Pipelines(); len(pipelines) > 0 {
+		return strings.Join(pipelines, ",")
+	}
+	if source.SpinnakerPipelineID != "" {
+		return source.SpinnakerPipelineID
+	}
+	return source.SpinnakerPipelineRegex
+}
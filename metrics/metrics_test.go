@@ -0,0 +1,78 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package metrics_test
+
+import (
+	"encoding/pem"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/metrics"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+var _ = Describe("Push", func() {
+	var (
+		pushgateway *ghttp.Server
+		source      concourse.Source
+	)
+
+	BeforeEach(func() {
+		pushgateway = ghttp.NewServer()
+		source = concourse.Source{
+			PushgatewayURL:       pushgateway.URL(),
+			SpinnakerApplication: "bar",
+			SpinnakerPipeline:    "foo",
+		}
+	})
+
+	AfterEach(func() {
+		pushgateway.Close()
+	})
+
+	It("groups the metrics by step, application and pipeline", func() {
+		pushgateway.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest("PUT", "/metrics/job/spinnaker_resource/step/check/application/bar/pipeline/foo"),
+			ghttp.RespondWith(200, ""),
+		))
+		Expect(metrics.Push(source, "check", nil)).To(Succeed())
+		Expect(pushgateway.ReceivedRequests()).To(HaveLen(1))
+	})
+
+	It("pushes with the TLS settings of the source", func() {
+		tlsPushgateway := ghttp.NewTLSServer()
+		defer tlsPushgateway.Close()
+		tlsPushgateway.AppendHandlers(ghttp.RespondWith(200, ""))
+		source.PushgatewayURL = tlsPushgateway.URL()
+		source.CACert = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: tlsPushgateway.HTTPTestServer.Certificate().Raw,
+		}))
+
+		transport, err := spinnaker.NewTransport(source)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metrics.Push(source, "check", transport)).To(Succeed())
+		Expect(tlsPushgateway.ReceivedRequests()).To(HaveLen(1))
+	})
+
+	It("encodes empty labels and ones with a slash", func() {
+		source.SpinnakerApplication = ""
+		source.SpinnakerPipeline = ""
+		source.SpinnakerAppRegex = "^web/.*$"
+		pushgateway.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest("PUT", "/metrics/job/spinnaker_resource/step/out/application@base64/XndlYi8uKiQ=/pipeline@base64/="),
+			ghttp.RespondWith(200, ""),
+		))
+		Expect(metrics.Push(source, "out", nil)).To(Succeed())
+		Expect(pushgateway.ReceivedRequests()).To(HaveLen(1))
+	})
+})
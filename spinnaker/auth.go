@@ -0,0 +1,526 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/colorstring"
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/metrics"
+	"github.com/pivotal-cf/spinnaker-resource/tracing"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	AuthMethodX509     = "x509"
+	AuthMethodOAuth2   = "oauth2"
+	AuthMethodToken    = "token"
+	AuthMethodBasic    = "basic"
+	AuthMethodIAP      = "iap"
+	AuthMethodLDAP     = "ldap"
+	AuthMethodSAML     = "saml"
+	AuthMethodSigV4    = "aws_sigv4"
+	AuthMethodOIDC     = "oidc"
+	AuthMethodKerberos = "kerberos"
+	AuthMethodAPIKey   = "api_key"
+)
+
+// Version of the resource, set at build time with
+// -ldflags "-X github.com/pivotal-cf/spinnaker-resource/spinnaker.Version=<version>"
+var Version = "dev"
+
+func UserAgent() string {
+	return "spinnaker-resource/" + Version
+}
+
+const defaultAPIKeyHeader = "X-Api-Key"
+
+const (
+	defaultConnectTimeout      = 10 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	defaultRequestTimeout      = 1 * time.Minute
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultMaxIdleConns        = 10
+)
+
+// tokens are refreshed this long before they actually expire
+const tokenExpiryLeeway = 30 * time.Second
+
+// AuthHttpClient sends requests to Gate with the credentials of an auth method attached
+type AuthHttpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+func NewAuthHttpClient(ctx context.Context, source concourse.Source) (AuthHttpClient, error) {
+	source, err := resolveVaultSecrets(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	switch source.AuthMethod {
+	case "", AuthMethodX509:
+		return NewX509AuthClient(source)
+	case AuthMethodOAuth2:
+		return NewOAuth2AuthClient(source)
+	case AuthMethodToken:
+		return NewTokenAuthClient(source)
+	case AuthMethodBasic:
+		return NewBasicAuthClient(source)
+	case AuthMethodIAP:
+		return NewIAPAuthClient(source)
+	case AuthMethodLDAP:
+		return NewLDAPAuthClient(source)
+	case AuthMethodSAML:
+		return NewSAMLAuthClient(source)
+	case AuthMethodSigV4:
+		return NewSigV4AuthClient(source)
+	case AuthMethodOIDC:
+		return NewOIDCAuthClient(source)
+	case AuthMethodKerberos:
+		return NewKerberosAuthClient(source)
+	case AuthMethodAPIKey:
+		return NewAPIKeyAuthClient(source)
+	}
+	return nil, fmt.Errorf("unsupported auth_method: %s", source.AuthMethod)
+}
+
+func newTLSConfig(source concourse.Source) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+		InsecureSkipVerify:       source.SkipTLSVerify,
+	}
+
+	if source.SkipTLSVerify {
+		concourse.Sayf(colorstring.Color("[yellow]WARNING: %s\n"), "skip_tls_verify is enabled, the TLS certificate presented by Spinnaker will not be verified")
+	}
+
+	if source.CACert != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM([]byte(source.CACert)) {
+			return nil, fmt.Errorf("ca_cert does not contain any valid PEM encoded certificates")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	return tlsConfig, nil
+}
+
+func newHTTPClient(source concourse.Source, certs ...tls.Certificate) (*http.Client, error) {
+	tr, err := newTransport(source, certs...)
+	if err != nil {
+		return nil, err
+	}
+	requestTimeout, err := parseTimeout(source.RequestTimeout, "request_timeout", defaultRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: &userAgentTransport{next: &tracingTransport{next: &metricsTransport{next: tr}}}, Timeout: requestTimeout}
+	if source.Debug {
+		client.Transport = newDebugTransport(client.Transport, source)
+	}
+	return client, nil
+}
+
+// NewTransport connects like the client reaching Gate, for the requests to
+// other endpoints the source configures, such as the Pushgateway
+func NewTransport(source concourse.Source) (*http.Transport, error) {
+	return newTransport(source)
+}
+
+// newTransport connects with the TLS, proxy and timeout settings of the source
+func newTransport(source concourse.Source, certs ...tls.Certificate) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(source)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.Certificates = certs
+
+	connectTimeout, err := parseTimeout(source.ConnectTimeout, "connect_timeout", defaultConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	tlsHandshakeTimeout, err := parseTimeout(source.TLSHandshakeTimeout, "tls_handshake_timeout", defaultTLSHandshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	//compression is left enabled, the transport asks for gzip and decompresses
+	//responses itself, which matters for the large execution lists of busy applications
+	idleConnTimeout, err := parseTimeout(source.IdleConnTimeout, "idle_conn_timeout", defaultIdleConnTimeout)
+	if err != nil {
+		return nil, err
+	}
+	maxIdleConns := source.MaxIdleConns
+	if maxIdleConns == 0 {
+		maxIdleConns = defaultMaxIdleConns
+	}
+
+	//one transport is shared by every request of a run, so connections to Gate are kept alive and reused
+	return &http.Transport{
+		Proxy:               newProxyFunc(source),
+		TLSClientConfig:     tlsConfig,
+		DialContext:         (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout: tlsHandshakeTimeout,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConns,
+		IdleConnTimeout:     idleConnTimeout,
+		DisableKeepAlives:   source.DisableKeepAlives,
+	}, nil
+}
+
+// userAgentTransport identifies the resource in Gate's access logs
+type userAgentTransport struct {
+	next http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", UserAgent())
+	return t.next.RoundTrip(req)
+}
+
+// metricsTransport records the status code and latency of every request
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		metrics.ObserveAPIRequest("error", time.Since(start))
+		return res, err
+	}
+	metrics.ObserveAPIRequest(strconv.Itoa(res.StatusCode), time.Since(start))
+	return res, nil
+}
+
+// tracingTransport records a span for every request and passes the trace on
+// to Gate
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span := tracing.StartSpan("HTTP " + req.Method)
+	defer span.End()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	if traceParent := span.TraceParent(); traceParent != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("traceparent", traceParent)
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.SetFailed()
+		return res, err
+	}
+	span.SetAttribute("http.status_code", strconv.Itoa(res.StatusCode))
+	if res.StatusCode >= 400 {
+		span.SetFailed()
+	}
+	return res, nil
+}
+
+// newProxyFunc uses the standard proxy environment variables, with any proxy
+// configured in the source taking precedence
+func newProxyFunc(source concourse.Source) func(*http.Request) (*url.URL, error) {
+	config := httpproxy.FromEnvironment()
+	if source.HTTPProxy != "" {
+		config.HTTPProxy = source.HTTPProxy
+	}
+	if source.HTTPSProxy != "" {
+		config.HTTPSProxy = source.HTTPSProxy
+	}
+	if source.NoProxy != "" {
+		config.NoProxy = source.NoProxy
+	}
+	proxyFunc := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
+func parseTimeout(value, field string, defaultTimeout time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", field, err)
+	}
+	return timeout, nil
+}
+
+type X509AuthClient struct {
+	client *http.Client
+}
+
+func NewX509AuthClient(source concourse.Source) (*X509AuthClient, error) {
+	certPEM, err := inlineOrFile(source.X509Cert, source.X509CertPath, "spinnaker_x509_cert", "x509_cert_path")
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := inlineOrFile(source.X509Key, source.X509KeyPath, "spinnaker_x509_key", "x509_key_path")
+	if err != nil {
+		return nil, err
+	}
+	if source.X509KeyPassword != "" {
+		keyPEM, err = decryptPrivateKeyPEM(keyPEM, source.X509KeyPassword)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newHTTPClient(source, cert)
+	if err != nil {
+		return nil, err
+	}
+	return &X509AuthClient{client: client}, nil
+}
+
+func (c *X509AuthClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req)
+}
+
+// TokenAuthClient sends a static, pre-issued bearer token
+type TokenAuthClient struct {
+	client *http.Client
+	token  string
+}
+
+func NewTokenAuthClient(source concourse.Source) (*TokenAuthClient, error) {
+	if source.BearerToken == "" {
+		return nil, fmt.Errorf("bearer_token must be set when using the %s auth method", AuthMethodToken)
+	}
+	client, err := newHTTPClient(source)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenAuthClient{
+		client: client,
+		token:  source.BearerToken,
+	}, nil
+}
+
+func (c *TokenAuthClient) Do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return c.client.Do(req)
+}
+
+// APIKeyAuthClient sends a static key in a configurable header, as expected by
+// API gateways such as Kong or Apigee
+type APIKeyAuthClient struct {
+	client *http.Client
+	header string
+	key    string
+}
+
+func NewAPIKeyAuthClient(source concourse.Source) (*APIKeyAuthClient, error) {
+	if source.APIKey == "" {
+		return nil, fmt.Errorf("api_key must be set when using the %s auth method", AuthMethodAPIKey)
+	}
+	header := source.APIKeyHeader
+	if header == "" {
+		header = defaultAPIKeyHeader
+	}
+
+	client, err := newHTTPClient(source)
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeyAuthClient{
+		client: client,
+		header: header,
+		key:    source.APIKey,
+	}, nil
+}
+
+func (c *APIKeyAuthClient) Do(req *http.Request) (*http.Response, error) {
+	req.Header.Set(c.header, c.key)
+	return c.client.Do(req)
+}
+
+// BasicAuthClient sends the configured username and password with every request
+type BasicAuthClient struct {
+	client   *http.Client
+	username string
+	password string
+}
+
+func NewBasicAuthClient(source concourse.Source) (*BasicAuthClient, error) {
+	if source.Username == "" || source.Password == "" {
+		return nil, fmt.Errorf("username and password must be set when using the %s auth method", AuthMethodBasic)
+	}
+	client, err := newHTTPClient(source)
+	if err != nil {
+		return nil, err
+	}
+	return &BasicAuthClient{
+		client:   client,
+		username: source.Username,
+		password: source.Password,
+	}, nil
+}
+
+func (c *BasicAuthClient) Do(req *http.Request) (*http.Response, error) {
+	req.SetBasicAuth(c.username, c.password)
+	return c.client.Do(req)
+}
+
+// inlineOrFile returns the inline value if it is set, otherwise the contents of the file at path
+func inlineOrFile(inline, path, inlineField, pathField string) ([]byte, error) {
+	if inline != "" && path != "" {
+		return nil, fmt.Errorf("only one of %s and %s can be set", inlineField, pathField)
+	}
+	if path == "" {
+		return []byte(inline), nil
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %s", pathField, err)
+	}
+	return contents, nil
+}
+
+// OAuth2AuthClient uses the client credentials grant to obtain a bearer token
+type OAuth2AuthClient struct {
+	client       *http.Client
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+type oauth2TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func NewOAuth2AuthClient(source concourse.Source) (*OAuth2AuthClient, error) {
+	if source.OAuth2TokenURL == "" {
+		return nil, fmt.Errorf("oauth2_token_url must be set when using the %s auth method", AuthMethodOAuth2)
+	}
+	if source.OAuth2ClientID == "" || source.OAuth2ClientSecret == "" {
+		return nil, fmt.Errorf("oauth2_client_id and oauth2_client_secret must be set when using the %s auth method", AuthMethodOAuth2)
+	}
+
+	client, err := newHTTPClient(source)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuth2AuthClient{
+		client:       client,
+		tokenURL:     source.OAuth2TokenURL,
+		clientID:     source.OAuth2ClientID,
+		clientSecret: source.OAuth2ClientSecret,
+		scopes:       source.OAuth2Scopes,
+	}, nil
+}
+
+func (c *OAuth2AuthClient) Do(req *http.Request) (*http.Response, error) {
+	token, err := c.accessToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return c.client.Do(req)
+}
+
+func (c *OAuth2AuthClient) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && (c.expiry.IsZero() || time.Now().Before(c.expiry)) {
+		return c.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	token, err := requestToken(c.client, req)
+	if err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint response did not contain an access_token")
+	}
+
+	c.token = token.AccessToken
+	c.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		c.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryLeeway)
+	}
+	return c.token, nil
+}
+
+func requestToken(client *http.Client, req *http.Request) (oauth2TokenResponse, error) {
+	var token oauth2TokenResponse
+
+	response, err := client.Do(req)
+	if err != nil {
+		return token, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return token, err
+	}
+	if response.StatusCode >= 400 {
+		return token, fmt.Errorf("token endpoint responded with status code: %d, body: %s", response.StatusCode, string(body))
+	}
+
+	err = json.Unmarshal(body, &token)
+	if err != nil {
+		return token, err
+	}
+	return token, nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+const (
+	defaultCircuitBreakerThreshold = 5
+	defaultCircuitBreakerCooldown  = 1 * time.Minute
+)
+
+// CircuitBreakerClient stops sending requests to Gate once threshold
+// consecutive requests have failed, until the cooldown has passed. The state
+// is kept in a file so it carries over between checks run in the same
+// container.
+type CircuitBreakerClient struct {
+	client    AuthHttpClient
+	api       string
+	threshold int
+	cooldown  time.Duration
+	stateFile string
+
+	mu sync.Mutex
+}
+
+type circuitBreakerState struct {
+	Failures int       `json:"failures"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+func NewCircuitBreakerClient(client AuthHttpClient, source concourse.Source) (*CircuitBreakerClient, error) {
+	threshold := source.CircuitBreakerThreshold
+	if threshold == 0 {
+		threshold = defaultCircuitBreakerThreshold
+	} else if threshold < 0 {
+		return nil, fmt.Errorf("circuit_breaker_threshold must be at least 1")
+	}
+
+	cooldown, err := parseTimeout(source.CircuitBreakerCooldown, "circuit_breaker_cooldown", defaultCircuitBreakerCooldown)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(source.SpinnakerAPI))
+	return &CircuitBreakerClient{
+		client:    client,
+		api:       source.SpinnakerAPI,
+		threshold: threshold,
+		cooldown:  cooldown,
+		stateFile: filepath.Join(os.TempDir(), fmt.Sprintf("spinnaker-resource-breaker-%x.json", sum[:8])),
+	}, nil
+}
+
+func (c *CircuitBreakerClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	state := c.loadState()
+	c.mu.Unlock()
+
+	if state.Failures >= c.threshold {
+		retryAt := state.OpenedAt.Add(c.cooldown)
+		if time.Now().Before(retryAt) {
+			return nil, fmt.Errorf("%w: the last %d requests to %s failed, not trying again until %s", ErrSpinnakerUnavailable, state.Failures, c.api, retryAt.Format(time.RFC3339))
+		}
+	}
+
+	res, err := c.client.Do(req)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state = c.loadState()
+	if err != nil || res.StatusCode >= 500 {
+		state.Failures++
+		if state.Failures >= c.threshold {
+			state.OpenedAt = time.Now()
+		}
+		c.saveState(state)
+	} else if state.Failures > 0 {
+		c.saveState(circuitBreakerState{})
+	}
+	return res, err
+}
+
+func (c *CircuitBreakerClient) loadState() circuitBreakerState {
+	var state circuitBreakerState
+	if contents, err := ioutil.ReadFile(c.stateFile); err == nil {
+		json.Unmarshal(contents, &state)
+	}
+	return state
+}
+
+// the breaker is best effort, failing to persist it should not fail the step
+func (c *CircuitBreakerClient) saveState(state circuitBreakerState) {
+	if contents, err := json.Marshal(state); err == nil {
+		ioutil.WriteFile(c.stateFile, contents, 0600)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+var _ = Describe("CircuitBreakerClient", func() {
+	var (
+		server   *ghttp.Server
+		source   concourse.Source
+		stateDir string
+		tmpDir   string
+	)
+
+	BeforeEach(func() {
+		var err error
+		stateDir, err = ioutil.TempDir("", "breaker")
+		Expect(err).ToNot(HaveOccurred())
+		tmpDir = os.Getenv("TMPDIR")
+		os.Setenv("TMPDIR", stateDir)
+
+		server = ghttp.NewServer()
+		source = concourse.Source{
+			SpinnakerAPI:            server.URL(),
+			AuthMethod:              spinnaker.AuthMethodToken,
+			BearerToken:             "some-service-token",
+			CircuitBreakerThreshold: 2,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.Setenv("TMPDIR", tmpDir)
+		os.RemoveAll(stateDir)
+	})
+
+	newClient := func() *spinnaker.CircuitBreakerClient {
+		authClient, err := spinnaker.NewAuthHttpClient(context.Background(), source)
+		Expect(err).ToNot(HaveOccurred())
+		client, err := spinnaker.NewCircuitBreakerClient(authClient, source)
+		Expect(err).ToNot(HaveOccurred())
+		return client
+	}
+
+	get := func(client *spinnaker.CircuitBreakerClient) (*http.Response, error) {
+		req, err := http.NewRequest("GET", server.URL()+"/applications/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		return client.Do(req)
+	}
+
+	It("short-circuits once the threshold of consecutive failures is reached", func() {
+		server.AppendHandlers(
+			ghttp.RespondWith(503, "unavailable"),
+			ghttp.RespondWith(503, "unavailable"),
+		)
+		client := newClient()
+
+		res, err := get(client)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(503))
+		res, err = get(client)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(503))
+
+		_, err = get(client)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spinnaker unavailable: the last 2 requests to " + server.URL() + " failed"))
+		Expect(server.ReceivedRequests()).To(HaveLen(2))
+	})
+
+	It("remembers the failures between runs", func() {
+		server.AppendHandlers(
+			ghttp.RespondWith(503, "unavailable"),
+			ghttp.RespondWith(503, "unavailable"),
+		)
+		get(newClient())
+		get(newClient())
+
+		_, err := get(newClient())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spinnaker unavailable"))
+	})
+
+	It("does not count client errors as failures", func() {
+		server.AppendHandlers(
+			ghttp.RespondWith(404, "not found"),
+			ghttp.RespondWith(404, "not found"),
+			ghttp.RespondWith(200, "{}"),
+		)
+		client := newClient()
+		get(client)
+		get(client)
+
+		res, err := get(client)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(200))
+	})
+
+	Context("when the cooldown has passed", func() {
+		BeforeEach(func() {
+			source.CircuitBreakerCooldown = "10ms"
+		})
+
+		It("tries Spinnaker again and closes when it succeeds", func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(503, "unavailable"),
+				ghttp.RespondWith(503, "unavailable"),
+				ghttp.RespondWith(200, "{}"),
+			)
+			client := newClient()
+			get(client)
+			get(client)
+
+			time.Sleep(20 * time.Millisecond)
+			res, err := get(client)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(200))
+		})
+	})
+})
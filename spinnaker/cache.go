@@ -0,0 +1,66 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// executionsCache keeps the last executions list Gate returned in the
+// container, so checks can send conditional requests and skip parsing the
+// list again when it hasn't changed
+type executionsCache struct {
+	ETag         string              `json:"etag"`
+	LastModified string              `json:"last_modified"`
+	Executions   []PipelineExecution `json:"executions"`
+}
+
+func executionsCachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("spinnaker-resource-executions-%x.json", sum[:8]))
+}
+
+func loadExecutionsCache(url string) executionsCache {
+	var cache executionsCache
+	if contents, err := ioutil.ReadFile(executionsCachePath(url)); err == nil {
+		json.Unmarshal(contents, &cache)
+	}
+	return cache
+}
+
+func (cache executionsCache) setConditionalHeaders(req *http.Request) {
+	if cache.ETag != "" {
+		req.Header.Set("If-None-Match", cache.ETag)
+	}
+	if cache.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cache.LastModified)
+	}
+}
+
+//the cache only saves work, failing to write it should not fail the check
+func saveExecutionsCache(url string, res *http.Response, executions []PipelineExecution) {
+	cache := executionsCache{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		Executions:   executions,
+	}
+	if cache.ETag == "" && cache.LastModified == "" {
+		return
+	}
+	if contents, err := json.Marshal(cache); err == nil {
+		ioutil.WriteFile(executionsCachePath(url), contents, 0600)
+	}
+}
@@ -11,100 +11,247 @@ package spinnaker
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 
+	"github.com/mitchellh/colorstring"
 	"github.com/pivotal-cf/spinnaker-resource/concourse"
 )
 
+const defaultCheckLimit = 25
+
+// maxExecutionPages bounds the pages of executions a check walks through
+const maxExecutionPages = 100
+
 type SpinClient struct {
 	sourceConfig concourse.Source
-	client       *http.Client
+	client       AuthHttpClient
+}
+
+func NewClient(ctx context.Context, source concourse.Source) (SpinClient, error) {
+	return newClient(ctx, source, true)
 }
 
-func NewClient(source concourse.Source) (SpinClient, error) {
+// NewReadClient returns a client for reading executions, which unlike NewClient doesn't scan the pipeline configs
+func NewReadClient(ctx context.Context, source concourse.Source) (SpinClient, error) {
+	return newClient(ctx, source, false)
+}
 
-	cert, err := tls.X509KeyPair([]byte(source.X509Cert), []byte(source.X509Key))
+func newClient(ctx context.Context, source concourse.Source, checkPipelines bool) (SpinClient, error) {
 
+	authClient, err := NewAuthHttpClient(ctx, source)
 	if err != nil {
 		return SpinClient{}, err
 	}
-	tlsConfig := &tls.Config{
-		MinVersion:               tls.VersionTLS12,
-		PreferServerCipherSuites: true,
-		Certificates:             []tls.Certificate{cert},
-		//TODO Do something!!
-		InsecureSkipVerify: true,
-	}
 
-	tr := &http.Transport{
-		TLSClientConfig: tlsConfig,
+	limitedClient, err := NewRateLimitClient(authClient, source)
+	if err != nil {
+		return SpinClient{}, err
 	}
 
-	client := &http.Client{Transport: tr}
-
-	res, err := client.Get(fmt.Sprintf("%s/applications/%s", source.SpinnakerAPI, source.SpinnakerApplication))
+	retryClient, err := NewRetryClient(limitedClient, source)
 	if err != nil {
 		return SpinClient{}, err
-	} else if res.StatusCode == 404 {
-		err = fmt.Errorf("spinnaker application %s not found", source.SpinnakerApplication)
-		return SpinClient{}, err
-	} else if res.StatusCode >= 400 {
-		body, err := ioutil.ReadAll(res.Body)
-		if err == nil {
-			err = fmt.Errorf("spinnaker api responded with status code: %d, body: %s", res.StatusCode, string(body))
-		}
-		return SpinClient{}, err
 	}
 
-	res, err = client.Get(fmt.Sprintf("%s/applications/%s/pipelineConfigs", source.SpinnakerAPI, source.SpinnakerApplication))
+	client, err := NewCircuitBreakerClient(retryClient, source)
 	if err != nil {
 		return SpinClient{}, err
-	} else if res.StatusCode >= 400 {
-		body, err := ioutil.ReadAll(res.Body)
-		if err == nil {
-			err = fmt.Errorf("spinnaker api responded with status code: %d, body: %s", res.StatusCode, string(body))
+	}
+
+	spinClient := SpinClient{
+		sourceConfig: source,
+		client:       client,
+	}
+
+	if !source.LazyValidation {
+		//the pipeline config of spinnaker_pipeline_id is found while resolving it
+		if err := spinClient.validate(ctx, checkPipelines && source.SpinnakerPipelineID == ""); err != nil {
 			return SpinClient{}, err
 		}
-	} else {
-		var pipelineConfigs []map[string]interface{}
-		body, err := ioutil.ReadAll(res.Body)
-		if err != nil {
+	}
+	if source.SpinnakerPipelineID != "" {
+		if err := spinClient.resolvePipelineID(ctx); err != nil {
 			return SpinClient{}, err
 		}
+	}
 
-		err = json.Unmarshal(body, &pipelineConfigs)
-		if err != nil {
-			return SpinClient{}, err
-		}
+	return spinClient, nil
+}
 
-		found := false
-		for _, pc := range pipelineConfigs {
-			if pc["name"].(string) == source.SpinnakerPipeline {
-				found = true
-				break
+func (c *SpinClient) validate(ctx context.Context, checkPipelines bool) error {
+	source := c.sourceConfig
+	//pipelines are only looked up in spinnaker_application, the other applications only have to exist
+	if source.SpinnakerApplication != "" || (len(source.SpinnakerApplications) == 0 && source.SpinnakerAppRegex == "") {
+		if err := c.checkApplication(ctx, source.SpinnakerApplication); err != nil {
+			return err
+		}
+		if checkPipelines {
+			if err := c.checkPipeline(ctx); err != nil {
+				return err
 			}
 		}
-		if !found {
-			err = fmt.Errorf("spinnaker pipeline %s not found", source.SpinnakerPipeline)
-			return SpinClient{}, err
+	}
+	for _, application := range source.SpinnakerApplications {
+		if err := c.checkApplication(ctx, application); err != nil {
+			return err
 		}
 	}
+	_, err := source.ApplicationRegex()
+	return err
+}
 
-	spinClient := SpinClient{
-		sourceConfig: source,
-		client:       client,
+// Source returns the source configuration, with the name of the spinnaker_pipeline_id pipeline resolved
+func (c *SpinClient) Source() concourse.Source {
+	return c.sourceConfig
+}
+
+// ForApplication returns a client fetching the executions of another application
+func (c *SpinClient) ForApplication(application string) SpinClient {
+	spinClient := *c
+	spinClient.sourceConfig.SpinnakerApplication = application
+	return spinClient
+}
+
+func (c *SpinClient) checkApplication(ctx context.Context, application string) error {
+	res, err := c.get(ctx, fmt.Sprintf("%s/applications/%s", c.sourceConfig.SpinnakerAPI, application))
+	if err != nil {
+		return err
 	}
-	return spinClient, nil
+	defer drainAndClose(res)
+
+	if res.StatusCode == 404 {
+		return &notFoundError{ErrApplicationNotFound, fmt.Sprintf("spinnaker application %s not found", application)}
+	} else if res.StatusCode >= 400 {
+		return newAPIError(res)
+	}
+	return nil
+}
+
+func (c *SpinClient) getPipelineConfigs(ctx context.Context) ([]map[string]interface{}, error) {
+	res, err := c.get(ctx, fmt.Sprintf("%s/applications/%s/pipelineConfigs", c.sourceConfig.SpinnakerAPI, c.sourceConfig.SpinnakerApplication))
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(res)
+
+	if res.StatusCode >= 400 {
+		return nil, newAPIError(res)
+	}
+
+	var pipelineConfigs []map[string]interface{}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(body, &pipelineConfigs)
+	if err != nil {
+		return nil, err
+	}
+	return pipelineConfigs, nil
+}
+
+//resolvePipelineID looks the name of the spinnaker_pipeline_id pipeline up, the executions are only searchable by name
+func (c *SpinClient) resolvePipelineID(ctx context.Context) error {
+	pipelineConfigs, err := c.getPipelineConfigs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, pc := range pipelineConfigs {
+		if id, _ := pc["id"].(string); id == c.sourceConfig.SpinnakerPipelineID {
+			c.sourceConfig.SpinnakerPipeline, _ = pc["name"].(string)
+			return nil
+		}
+	}
+	return &notFoundError{ErrPipelineNotFound, fmt.Sprintf("spinnaker pipeline with id %s not found", c.sourceConfig.SpinnakerPipelineID)}
+}
+
+func (c *SpinClient) checkPipeline(ctx context.Context) error {
+	pipelineConfigs, err := c.getPipelineConfigs(ctx)
+	if err != nil {
+		return err
+	}
+
+	pipelines := c.sourceConfig.Pipelines()
+	if len(pipelines) == 0 && c.sourceConfig.SpinnakerPipelineRegex == "" {
+		pipelines = []string{c.sourceConfig.SpinnakerPipeline}
+	}
+	//pipelines matching the regex may not have been generated yet so only its syntax is checked
+	if _, err := c.sourceConfig.PipelineRegex(); err != nil {
+		return err
+	}
+	for _, pipeline := range pipelines {
+		if !hasPipelineConfig(pipelineConfigs, pipeline) {
+			return &notFoundError{ErrPipelineNotFound, fmt.Sprintf("spinnaker pipeline %s not found", pipeline)}
+		}
+	}
+	return nil
+}
+
+func hasPipelineConfig(pipelineConfigs []map[string]interface{}, name string) bool {
+	for _, pc := range pipelineConfigs {
+		if pc["name"].(string) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// drainAndClose lets the transport reuse the connection for the next request
+func drainAndClose(res *http.Response) {
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+}
+
+func (c *SpinClient) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+func (c *SpinClient) post(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	//Fiat runs the execution with the permissions of this user instead of the authenticated one
+	if c.sourceConfig.RunAsUser != "" {
+		req.Header.Set("X-SPINNAKER-USER", c.sourceConfig.RunAsUser)
+	}
+	return c.client.Do(req)
 }
 
-func (c *SpinClient) GetPipelineExecution(pipelineExecutionID string) (map[string]interface{}, error) {
+func (c *SpinClient) put(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.client.Do(req)
+}
+
+func (c *SpinClient) patch(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.client.Do(req)
+}
+
+func (c *SpinClient) GetPipelineExecution(ctx context.Context, pipelineExecutionID string) (map[string]interface{}, error) {
 	var pipelineExecutionMetadata map[string]interface{}
-	bytes, err := c.GetPipelineExecutionRaw(pipelineExecutionID)
+	bytes, err := c.GetPipelineExecutionRaw(ctx, pipelineExecutionID)
 	if err != nil {
 		return nil, err
 	}
@@ -115,20 +262,18 @@ func (c *SpinClient) GetPipelineExecution(pipelineExecutionID string) (map[strin
 	return pipelineExecutionMetadata, nil
 }
 
-func (c *SpinClient) GetPipelineExecutionRaw(pipelineExecutionID string) ([]byte, error) {
+func (c *SpinClient) GetPipelineExecutionRaw(ctx context.Context, pipelineExecutionID string) ([]byte, error) {
 	url := fmt.Sprintf("%s/pipelines/%s", c.sourceConfig.SpinnakerAPI, pipelineExecutionID)
-	response, err := c.client.Get(url)
+	response, err := c.get(ctx, url)
 	if err != nil {
 		return nil, err
-	} else if response.StatusCode == 404 {
-		err = fmt.Errorf("pipeline execution ID not found (ID: %s)", pipelineExecutionID)
-		return nil, err
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode == 404 {
+		return nil, &notFoundError{ErrPipelineExecutionNotFound, fmt.Sprintf("pipeline execution ID not found (ID: %s)", pipelineExecutionID)}
 	} else if response.StatusCode >= 400 {
-		body, err := ioutil.ReadAll(response.Body)
-		if err == nil {
-			err = fmt.Errorf("spinnaker api responded with status code: %d, body: %s", response.StatusCode, string(body))
-		}
-		return nil, err
+		return nil, newAPIError(response)
 	}
 	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
@@ -137,48 +282,346 @@ func (c *SpinClient) GetPipelineExecutionRaw(pipelineExecutionID string) ([]byte
 	return body, nil
 }
 
-//returns the last 25 spinnaker pipeline executions
-func (c *SpinClient) GetPipelineExecutions() ([]PipelineExecution, error) {
-	var pipelineExecutions []PipelineExecution
+// CancelPipelineExecution cancels a running execution, recording the reason in it
+func (c *SpinClient) CancelPipelineExecution(ctx context.Context, pipelineExecutionID, reason string) error {
+	url := fmt.Sprintf("%s/pipelines/%s/cancel?reason=%s", c.sourceConfig.SpinnakerAPI, pipelineExecutionID, url.QueryEscape(reason))
+	response, err := c.put(ctx, url, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode >= 400 {
+		return newAPIError(response)
+	}
+	return nil
+}
 
-	//TODO What does expand do ??
-	url := fmt.Sprintf("%s/applications/%s/pipelines?limit=25", c.sourceConfig.SpinnakerAPI, c.sourceConfig.SpinnakerApplication)
+// SubmitManualJudgment judges a Manual Judgment stage of an execution, with
+// a judgmentStatus of continue or stop and the judgmentInput
+func (c *SpinClient) SubmitManualJudgment(ctx context.Context, pipelineExecutionID, stageID string, judgment []byte) error {
+	url := fmt.Sprintf("%s/pipelines/%s/stages/%s", c.sourceConfig.SpinnakerAPI, pipelineExecutionID, stageID)
+	response, err := c.patch(ctx, url, "application/json", bytes.NewReader(judgment))
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(response)
 
-	if response, err := c.client.Get(url); err != nil {
+	if response.StatusCode >= 400 {
+		return newAPIError(response)
+	}
+	return nil
+}
+
+// RestartStage restarts a stage of an execution, resuming the execution from it
+func (c *SpinClient) RestartStage(ctx context.Context, pipelineExecutionID, stageID string) error {
+	url := fmt.Sprintf("%s/pipelines/%s/stages/%s/restart", c.sourceConfig.SpinnakerAPI, pipelineExecutionID, stageID)
+	response, err := c.put(ctx, url, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode >= 400 {
+		return newAPIError(response)
+	}
+	return nil
+}
+
+// PausePipelineExecution pauses a running execution until it is resumed
+func (c *SpinClient) PausePipelineExecution(ctx context.Context, pipelineExecutionID string) error {
+	return c.updatePipelineExecution(ctx, pipelineExecutionID, "pause")
+}
+
+// ResumePipelineExecution resumes a paused execution
+func (c *SpinClient) ResumePipelineExecution(ctx context.Context, pipelineExecutionID string) error {
+	return c.updatePipelineExecution(ctx, pipelineExecutionID, "resume")
+}
+
+func (c *SpinClient) updatePipelineExecution(ctx context.Context, pipelineExecutionID, operation string) error {
+	url := fmt.Sprintf("%s/pipelines/%s/%s", c.sourceConfig.SpinnakerAPI, pipelineExecutionID, operation)
+	response, err := c.put(ctx, url, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode >= 400 {
+		return newAPIError(response)
+	}
+	return nil
+}
+
+// FetchArtifact has Gate download the contents of an artifact with the
+// credentials of its artifact account, and copies them to w
+func (c *SpinClient) FetchArtifact(ctx context.Context, artifact []byte, w io.Writer) error {
+	url := fmt.Sprintf("%s/artifacts/fetch/", c.sourceConfig.SpinnakerAPI)
+	response, err := c.put(ctx, url, "application/json", bytes.NewReader(artifact))
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode >= 400 {
+		return newAPIError(response)
+	}
+	_, err = io.Copy(w, response.Body)
+	return err
+}
+
+// GetCanaryResult returns the judgment Kayenta made in a canary analysis
+func (c *SpinClient) GetCanaryResult(ctx context.Context, canaryExecutionID string) ([]byte, error) {
+	url := fmt.Sprintf("%s/v2/canaries/canary/%s", c.sourceConfig.SpinnakerAPI, canaryExecutionID)
+	response, err := c.get(ctx, url)
+	if err != nil {
 		return nil, err
-	} else if response.StatusCode >= 400 {
-		body, err := ioutil.ReadAll(response.Body)
-		if err == nil {
-			err = fmt.Errorf("spinnaker api responded with status code: %d, body: %s", response.StatusCode, string(body))
-		}
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode >= 400 {
+		return nil, newAPIError(response)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+// GetPodLogs returns the logs of a Kubernetes pod, such as one a Run Job stage ran
+func (c *SpinClient) GetPodLogs(ctx context.Context, account, namespace, pod string) ([]byte, error) {
+	url := fmt.Sprintf("%s/applications/%s/kubernetes/pods/%s/%s/%s/logs", c.sourceConfig.SpinnakerAPI, c.sourceConfig.SpinnakerApplication, account, namespace, pod)
+	response, err := c.get(ctx, url)
+	if err != nil {
 		return nil, err
-	} else {
-		body, err := ioutil.ReadAll(response.Body)
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode >= 400 {
+		return nil, newAPIError(response)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+// GetEntityTags returns the entity tags of an entity, such as a server group
+// deployed to an account and region
+func (c *SpinClient) GetEntityTags(ctx context.Context, entityType, entityID, account, region string) ([]byte, error) {
+	query := url.Values{"entityType": {entityType}, "entityId": {entityID}}
+	if account != "" {
+		query.Set("account", account)
+	}
+	if region != "" {
+		query.Set("region", region)
+	}
+	response, err := c.get(ctx, fmt.Sprintf("%s/tags?%s", c.sourceConfig.SpinnakerAPI, query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode >= 400 {
+		return nil, newAPIError(response)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+// GetApplications returns the names of every application in Spinnaker
+func (c *SpinClient) GetApplications(ctx context.Context) ([]string, error) {
+	response, err := c.get(ctx, fmt.Sprintf("%s/applications", c.sourceConfig.SpinnakerAPI))
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode >= 400 {
+		return nil, newAPIError(response)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	var applications []struct {
+		Name string `json:"name"`
+	}
+	err = json.Unmarshal(body, &applications)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(applications))
+	for _, application := range applications {
+		names = append(names, application.Name)
+	}
+	return names, nil
+}
+
+// ExecutionsQuery narrows down the executions Gate searches for, so that it
+// filters them server-side instead of the resource scanning every execution
+// of the application
+type ExecutionsQuery struct {
+	PipelineName             string
+	TriggerTimeStartBoundary uint64
+	Statuses                 []string
+	EventID                  string
+}
+
+func (q ExecutionsQuery) rawQuery(startIndex, size int) string {
+	var params []string
+	if q.TriggerTimeStartBoundary != 0 {
+		params = append(params, fmt.Sprintf("triggerTimeStartBoundary=%d", q.TriggerTimeStartBoundary))
+	}
+	params = append(params, fmt.Sprintf("startIndex=%d", startIndex), fmt.Sprintf("size=%d", size))
+	if q.PipelineName != "" {
+		params = append(params, "pipelineName="+url.QueryEscape(q.PipelineName))
+	}
+	if len(q.Statuses) > 0 {
+		//Gate matches the upper case statuses exactly
+		params = append(params, "statuses="+url.QueryEscape(strings.ToUpper(strings.Join(q.Statuses, ","))))
+	}
+	if q.EventID != "" {
+		params = append(params, "eventId="+url.QueryEscape(q.EventID))
+	}
+	return strings.Join(params, "&")
+}
+
+func (c *SpinClient) searchURL(query ExecutionsQuery, startIndex, size int) string {
+	return fmt.Sprintf("%s/applications/%s/executions/search?%s",
+		c.sourceConfig.SpinnakerAPI, c.sourceConfig.SpinnakerApplication, query.rawQuery(startIndex, size))
+}
+
+//returns the last check_limit spinnaker pipeline executions matching the query, 25 by default
+func (c *SpinClient) GetPipelineExecutions(ctx context.Context, query ExecutionsQuery) ([]PipelineExecution, error) {
+	url := c.searchURL(query, 0, c.checkLimit())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	//the initial_max_age boundary moves with every check, and would otherwise
+	//leave a cache entry behind each time; check drops older executions itself
+	cacheKey := query
+	cacheKey.TriggerTimeStartBoundary = 0
+	cacheURL := c.searchURL(cacheKey, 0, c.checkLimit())
+	cache := loadExecutionsCache(cacheURL)
+	cache.setConditionalHeaders(req)
+
+	response, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode == http.StatusNotModified {
+		return cache.Executions, nil
+	}
+	pipelineExecutions, err := readExecutions(response)
+	if err != nil {
+		return nil, err
+	}
+	saveExecutionsCache(cacheURL, response, pipelineExecutions)
+	return pipelineExecutions, nil
+}
+
+// GetPipelineExecutionsSince pages through every execution of the application
+// matching the query triggered at or after buildTime, however many there are.
+// Older Gates ignore startIndex or triggerTimeStartBoundary, so paging also
+// stops at a page holding no new executions or only older ones, and after
+// maxExecutionPages pages at most.
+func (c *SpinClient) GetPipelineExecutionsSince(ctx context.Context, buildTime uint64, query ExecutionsQuery) ([]PipelineExecution, error) {
+	var pipelineExecutions []PipelineExecution
+	seen := map[string]bool{}
+	size := c.checkLimit()
+	query.TriggerTimeStartBoundary = buildTime
+
+	for pageIndex := 0; pageIndex < maxExecutionPages; pageIndex++ {
+		response, err := c.get(ctx, c.searchURL(query, pageIndex*size, size))
 		if err != nil {
 			return nil, err
 		}
-		err = json.Unmarshal(body, &pipelineExecutions)
+		page, err := readExecutions(response)
+		drainAndClose(response)
 		if err != nil {
 			return nil, err
 		}
-		return pipelineExecutions, nil
+
+		repeated, older := true, true
+		for _, execution := range page {
+			if execution.BuildTime >= buildTime {
+				older = false
+			}
+			if seen[execution.ID] {
+				continue
+			}
+			seen[execution.ID] = true
+			repeated = false
+			pipelineExecutions = append(pipelineExecutions, execution)
+		}
+		if len(page) < size || repeated || older {
+			return pipelineExecutions, nil
+		}
 	}
+	concourse.Sayf(colorstring.Color("[yellow]WARNING: %s\n"), fmt.Sprintf("stopped paging through the executions of %s after %d pages", c.sourceConfig.SpinnakerApplication, maxExecutionPages))
+	return pipelineExecutions, nil
 }
 
-func (c *SpinClient) InvokePipelineExecution(body []byte) (PipelineExecution, error) {
+// GetPipelineExecutionByEventID finds the execution of the pipeline that was
+// triggered with eventID, for systems that only know the eventId they supplied
+func (c *SpinClient) GetPipelineExecutionByEventID(ctx context.Context, eventID string) (PipelineExecution, error) {
+	query := ExecutionsQuery{PipelineName: c.sourceConfig.SpinnakerPipeline, EventID: eventID}
+	response, err := c.get(ctx, c.searchURL(query, 0, c.checkLimit()))
+	if err != nil {
+		return PipelineExecution{}, err
+	}
+	defer drainAndClose(response)
+
+	pipelineExecutions, err := readExecutions(response)
+	if err != nil {
+		return PipelineExecution{}, err
+	}
+	if len(pipelineExecutions) == 0 {
+		return PipelineExecution{}, &notFoundError{ErrPipelineExecutionNotFound, fmt.Sprintf("pipeline execution not found (eventId: %s)", eventID)}
+	}
+	return pipelineExecutions[0], nil
+}
+
+func (c *SpinClient) checkLimit() int {
+	if c.sourceConfig.CheckLimit == 0 {
+		return defaultCheckLimit
+	}
+	return c.sourceConfig.CheckLimit
+}
+
+func readExecutions(response *http.Response) ([]PipelineExecution, error) {
+	if response.StatusCode >= 400 {
+		return nil, newAPIError(response)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	var pipelineExecutions []PipelineExecution
+	err = json.Unmarshal(body, &pipelineExecutions)
+	if err != nil {
+		return nil, err
+	}
+	return pipelineExecutions, nil
+}
+
+func (c *SpinClient) InvokePipelineExecution(ctx context.Context, body []byte) (PipelineExecution, error) {
 
 	pipelineExecution := PipelineExecution{}
 
-	url := fmt.Sprintf("%s/pipelines/%s/%s", c.sourceConfig.SpinnakerAPI, c.sourceConfig.SpinnakerApplication, c.sourceConfig.SpinnakerPipeline)
+	//Gate finds pipelines by their config ID too, which survives renames in Deck
+	pipeline := c.sourceConfig.SpinnakerPipeline
+	if c.sourceConfig.SpinnakerPipelineID != "" {
+		pipeline = c.sourceConfig.SpinnakerPipelineID
+	}
+	url := fmt.Sprintf("%s/pipelines/%s/%s", c.sourceConfig.SpinnakerAPI, c.sourceConfig.SpinnakerApplication, pipeline)
 
-	if response, err := c.client.Post(url, "application/json", bytes.NewBuffer(body)); err != nil {
-		return pipelineExecution, err
-	} else if response.StatusCode >= 400 {
-		body, err := ioutil.ReadAll(response.Body)
-		if err == nil {
-			err = fmt.Errorf("spinnaker api responded with status code: %d, body: %s", response.StatusCode, string(body))
-		}
+	response, err := c.post(ctx, url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
 		return pipelineExecution, err
+	}
+	defer drainAndClose(response)
+
+	if response.StatusCode >= 400 {
+		return pipelineExecution, newAPIError(response)
 	} else {
 		body, err := ioutil.ReadAll(response.Body)
 		if err != nil {
@@ -10,7 +10,15 @@ Unless required by applicable law or agreed to in writing, software distributed
 package spinnaker_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -76,6 +84,304 @@ var (
 )
 
 var _ = Describe("Spinnaker Client", func() {
+	Context("When fetching the executions since a previous one", func() {
+		BeforeEach(func() {
+			spinnakerServer = ghttp.NewServer()
+			spinnakerServer.AppendHandlers(
+				ghttp.RespondWith(200, `{"name":"existent_app"}`),
+				ghttp.RespondWith(200, `[{"name":"existent_pipeline"}]`),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/applications/existent_app/executions/search", "triggerTimeStartBoundary=100&startIndex=0&size=2&pipelineName=existent_pipeline"),
+					ghttp.RespondWith(200, `[{"id":"EX3","buildTime":300},{"id":"EX2","buildTime":200}]`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/applications/existent_app/executions/search", "triggerTimeStartBoundary=100&startIndex=2&size=2&pipelineName=existent_pipeline"),
+					ghttp.RespondWith(200, `[{"id":"EX1","buildTime":100}]`),
+				),
+			)
+		})
+
+		AfterEach(func() {
+			spinnakerServer.Close()
+		})
+
+		It("pages through the executions until the last page", func() {
+			client, err := spinnaker.NewClient(context.Background(), concourse.Source{
+				SpinnakerAPI:         spinnakerServer.URL(),
+				SpinnakerApplication: "existent_app",
+				SpinnakerPipeline:    "existent_pipeline",
+				X509Cert:             serverCert,
+				X509Key:              serverKey,
+				CheckLimit:           2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			executions, err := client.GetPipelineExecutionsSince(context.Background(), 100, spinnaker.ExecutionsQuery{PipelineName: "existent_pipeline"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(executions).To(Equal([]spinnaker.PipelineExecution{
+				{ID: "EX3", BuildTime: 300},
+				{ID: "EX2", BuildTime: 200},
+				{ID: "EX1", BuildTime: 100},
+			}))
+		})
+	})
+
+	Context("When Gate ignores the startIndex of the executions search", func() {
+		BeforeEach(func() {
+			spinnakerServer = ghttp.NewServer()
+			spinnakerServer.AppendHandlers(
+				ghttp.RespondWith(200, `{"name":"existent_app"}`),
+				ghttp.RespondWith(200, `[{"name":"existent_pipeline"}]`),
+			)
+		})
+
+		AfterEach(func() {
+			spinnakerServer.Close()
+		})
+
+		newClient := func() *spinnaker.SpinClient {
+			client, err := spinnaker.NewClient(context.Background(), concourse.Source{
+				SpinnakerAPI:         spinnakerServer.URL(),
+				SpinnakerApplication: "existent_app",
+				SpinnakerPipeline:    "existent_pipeline",
+				X509Cert:             serverCert,
+				X509Key:              serverKey,
+				CheckLimit:           2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			return &client
+		}
+
+		It("stops at a page repeating the executions already returned", func() {
+			spinnakerServer.RouteToHandler("GET", "/applications/existent_app/executions/search",
+				ghttp.RespondWith(200, `[{"id":"EX3","buildTime":300},{"id":"EX2","buildTime":200}]`))
+
+			executions, err := newClient().GetPipelineExecutionsSince(context.Background(), 100, spinnaker.ExecutionsQuery{PipelineName: "existent_pipeline"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(executions).To(Equal([]spinnaker.PipelineExecution{
+				{ID: "EX3", BuildTime: 300},
+				{ID: "EX2", BuildTime: 200},
+			}))
+			Expect(spinnakerServer.ReceivedRequests()).To(HaveLen(4))
+		})
+
+		It("stops at a page of executions older than the previous one", func() {
+			pages := map[string]string{
+				"0": `[{"id":"EX5","buildTime":300},{"id":"EX4","buildTime":200}]`,
+				"2": `[{"id":"EX3","buildTime":100},{"id":"EX2","buildTime":90}]`,
+				"4": `[{"id":"EX1","buildTime":80},{"id":"EX0","buildTime":70}]`,
+			}
+			spinnakerServer.RouteToHandler("GET", "/applications/existent_app/executions/search", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(pages[r.URL.Query().Get("startIndex")]))
+			})
+
+			executions, err := newClient().GetPipelineExecutionsSince(context.Background(), 100, spinnaker.ExecutionsQuery{PipelineName: "existent_pipeline"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(executions).To(HaveLen(6))
+			Expect(spinnakerServer.ReceivedRequests()).To(HaveLen(5))
+		})
+
+		It("stops after a bounded number of pages", func() {
+			spinnakerServer.RouteToHandler("GET", "/applications/existent_app/executions/search", func(w http.ResponseWriter, r *http.Request) {
+				startIndex := r.URL.Query().Get("startIndex")
+				fmt.Fprintf(w, `[{"id":"EX%s-0","buildTime":300},{"id":"EX%s-1","buildTime":300}]`, startIndex, startIndex)
+			})
+
+			executions, err := newClient().GetPipelineExecutionsSince(context.Background(), 100, spinnaker.ExecutionsQuery{PipelineName: "existent_pipeline"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(executions).To(HaveLen(200))
+			Expect(spinnakerServer.ReceivedRequests()).To(HaveLen(102))
+		})
+	})
+
+	Context("When looking up an execution by its eventId", func() {
+		BeforeEach(func() {
+			spinnakerServer = ghttp.NewServer()
+			spinnakerServer.AppendHandlers(
+				ghttp.RespondWith(200, `{"name":"existent_app"}`),
+				ghttp.RespondWith(200, `[{"name":"existent_pipeline"}]`),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/applications/existent_app/executions/search", "startIndex=0&size=25&pipelineName=existent_pipeline&eventId=change-42"),
+					ghttp.RespondWith(200, `[{"id":"EX3","buildTime":300}]`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/applications/existent_app/executions/search", "startIndex=0&size=25&pipelineName=existent_pipeline&eventId=unknown"),
+					ghttp.RespondWith(200, `[]`),
+				),
+			)
+		})
+
+		AfterEach(func() {
+			spinnakerServer.Close()
+		})
+
+		It("returns the execution triggered with the eventId, or a not found error", func() {
+			client, err := spinnaker.NewClient(context.Background(), concourse.Source{
+				SpinnakerAPI:         spinnakerServer.URL(),
+				SpinnakerApplication: "existent_app",
+				SpinnakerPipeline:    "existent_pipeline",
+				X509Cert:             serverCert,
+				X509Key:              serverKey,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			execution, err := client.GetPipelineExecutionByEventID(context.Background(), "change-42")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(execution.ID).To(Equal("EX3"))
+
+			_, err = client.GetPipelineExecutionByEventID(context.Background(), "unknown")
+			Expect(errors.Is(err, spinnaker.ErrPipelineExecutionNotFound)).To(BeTrue())
+		})
+	})
+
+	Context("When watching applications matching a regex", func() {
+		BeforeEach(func() {
+			spinnakerServer = ghttp.NewServer()
+			spinnakerServer.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/applications"),
+					ghttp.RespondWith(200, `[{"name":"checkout"},{"name":"payments"}]`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/applications/payments/executions/search", "startIndex=0&size=25"),
+					ghttp.RespondWith(200, `[{"id":"EX1","application":"payments"}]`),
+				),
+			)
+		})
+
+		AfterEach(func() {
+			spinnakerServer.Close()
+		})
+
+		It("lists the applications and fetches the executions of another one", func() {
+			client, err := spinnaker.NewClient(context.Background(), concourse.Source{
+				SpinnakerAPI:      spinnakerServer.URL(),
+				SpinnakerAppRegex: "pay.*",
+				X509Cert:          serverCert,
+				X509Key:           serverKey,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			applications, err := client.GetApplications(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(applications).To(Equal([]string{"checkout", "payments"}))
+
+			paymentsClient := client.ForApplication("payments")
+			executions, err := paymentsClient.GetPipelineExecutions(context.Background(), spinnaker.ExecutionsQuery{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(executions).To(Equal([]spinnaker.PipelineExecution{{ID: "EX1", Application: "payments"}}))
+		})
+	})
+
+	Context("When the executions list has not changed since the last check", func() {
+		var (
+			cacheDir, tmpDir string
+			client           spinnaker.SpinClient
+		)
+
+		BeforeEach(func() {
+			var err error
+			cacheDir, err = ioutil.TempDir("", "executions-cache")
+			Expect(err).ToNot(HaveOccurred())
+			tmpDir = os.Getenv("TMPDIR")
+			os.Setenv("TMPDIR", cacheDir)
+
+			spinnakerServer = ghttp.NewServer()
+			spinnakerServer.AppendHandlers(
+				ghttp.RespondWith(200, `{"name":"existent_app"}`),
+				ghttp.RespondWith(200, `[{"name":"existent_pipeline"}]`),
+				ghttp.RespondWith(200, `[{"id":"EX1","name":"existent_pipeline","buildTime":1,"status":"SUCCEEDED"}]`, http.Header{"Etag": []string{`"v1"`}}),
+				ghttp.CombineHandlers(
+					ghttp.VerifyHeaderKV("If-None-Match", `"v1"`),
+					ghttp.RespondWith(304, ""),
+				),
+			)
+
+			client, err = spinnaker.NewClient(context.Background(), concourse.Source{
+				SpinnakerAPI:         spinnakerServer.URL(),
+				SpinnakerApplication: "existent_app",
+				SpinnakerPipeline:    "existent_pipeline",
+				X509Cert:             serverCert,
+				X509Key:              serverKey,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			spinnakerServer.Close()
+			os.Setenv("TMPDIR", tmpDir)
+			os.RemoveAll(cacheDir)
+		})
+
+		It("sends a conditional request and returns the cached executions", func() {
+			first, err := client.GetPipelineExecutions(context.Background(), spinnaker.ExecutionsQuery{})
+			Expect(err).ToNot(HaveOccurred())
+			second, err := client.GetPipelineExecutions(context.Background(), spinnaker.ExecutionsQuery{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(spinnakerServer.ReceivedRequests()).To(HaveLen(4))
+			Expect(second).To(Equal(first))
+			Expect(second).To(Equal([]spinnaker.PipelineExecution{
+				{ID: "EX1", Name: "existent_pipeline", BuildTime: 1, Status: "SUCCEEDED"},
+			}))
+		})
+
+		It("shares the cached executions between trigger time boundaries", func() {
+			_, err := client.GetPipelineExecutions(context.Background(), spinnaker.ExecutionsQuery{TriggerTimeStartBoundary: 1})
+			Expect(err).ToNot(HaveOccurred())
+			second, err := client.GetPipelineExecutions(context.Background(), spinnaker.ExecutionsQuery{TriggerTimeStartBoundary: 2})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(spinnakerServer.ReceivedRequests()).To(HaveLen(4))
+			Expect(second).To(Equal([]spinnaker.PipelineExecution{
+				{ID: "EX1", Name: "existent_pipeline", BuildTime: 1, Status: "SUCCEEDED"},
+			}))
+			cached, err := filepath.Glob(filepath.Join(cacheDir, "spinnaker-resource-executions-*"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cached).To(HaveLen(1))
+		})
+	})
+
+	Context("When making several requests", func() {
+		var newConns int32
+
+		BeforeEach(func() {
+			newConns = 0
+			spinnakerServer = ghttp.NewUnstartedServer()
+			spinnakerServer.HTTPTestServer.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&newConns, 1)
+				}
+			}
+			spinnakerServer.Start()
+			spinnakerServer.AppendHandlers(
+				ghttp.RespondWith(200, `{"name":"existent_app"}`),
+				ghttp.RespondWith(200, `[{"name":"existent_pipeline"}]`),
+				ghttp.RespondWith(200, `[]`),
+			)
+		})
+
+		AfterEach(func() {
+			spinnakerServer.Close()
+		})
+
+		It("reuses the connection to Spinnaker", func() {
+			client, err := spinnaker.NewClient(context.Background(), concourse.Source{
+				SpinnakerAPI:         spinnakerServer.URL(),
+				SpinnakerApplication: "existent_app",
+				SpinnakerPipeline:    "existent_pipeline",
+				X509Cert:             serverCert,
+				X509Key:              serverKey,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = client.GetPipelineExecutions(context.Background(), spinnaker.ExecutionsQuery{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(spinnakerServer.ReceivedRequests()).To(HaveLen(3))
+			Expect(atomic.LoadInt32(&newConns)).To(Equal(int32(1)))
+		})
+	})
+
 	Context("When creating a new spinnaker client", func() {
 		JustBeforeEach(func() {
 			spinnakerServer = ghttp.NewServer()
@@ -91,7 +397,7 @@ var _ = Describe("Spinnaker Client", func() {
 					X509Cert:             "",
 					X509Key:              "",
 				}
-				_, err := spinnaker.NewClient(source)
+				_, err := spinnaker.NewClient(context.Background(), source)
 				Expect(err).To(HaveOccurred())
 			})
 		})
@@ -124,10 +430,11 @@ var _ = Describe("Spinnaker Client", func() {
 					X509Cert:             serverCert,
 					X509Key:              serverKey,
 				}
-				_, err := spinnaker.NewClient(source)
+				_, err := spinnaker.NewClient(context.Background(), source)
 
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(Equal("spinnaker application " + applicationName + " not found"))
+				Expect(errors.Is(err, spinnaker.ErrApplicationNotFound)).To(BeTrue())
 			})
 		})
 
@@ -172,10 +479,11 @@ var _ = Describe("Spinnaker Client", func() {
 						X509Cert:             serverCert,
 						X509Key:              serverKey,
 					}
-					_, err := spinnaker.NewClient(source)
+					_, err := spinnaker.NewClient(context.Background(), source)
 
 					Expect(err).To(HaveOccurred())
 					Expect(err.Error()).To(Equal("spinnaker pipeline " + pipelineName + " not found"))
+					Expect(errors.Is(err, spinnaker.ErrPipelineNotFound)).To(BeTrue())
 				})
 			})
 
@@ -201,9 +509,68 @@ var _ = Describe("Spinnaker Client", func() {
 						X509Cert:             serverCert,
 						X509Key:              serverKey,
 					}
-					_, err := spinnaker.NewClient(source)
+					_, err := spinnaker.NewClient(context.Background(), source)
+
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("returns an error when one of several pipelines does not exist", func() {
+					source := concourse.Source{
+						SpinnakerAPI:         spinnakerServer.URL(),
+						SpinnakerApplication: applicationName,
+						SpinnakerPipelines:   []string{"existent_pipeline", "nonexistent_pipeline"},
+						X509Cert:             serverCert,
+						X509Key:              serverKey,
+					}
+					_, err := spinnaker.NewClient(context.Background(), source)
+
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(Equal("spinnaker pipeline nonexistent_pipeline not found"))
+				})
+			})
+
+			Context("Given a pipeline id", func() {
+				BeforeEach(func() {
+					pipelineConfigHandler = ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", MatchRegexp(".*/applications/"+applicationName+"/pipelineConfigs")),
+						ghttp.RespondWithJSONEncoded(
+							statusCode,
+							[]map[string]interface{}{
+								{"id": "3f5a9c2e", "name": "renamed_pipeline"},
+								{"id": "71b0d4aa", "name": "existent_pipeline2"},
+							},
+						),
+					)
+				})
+
+				It("resolves the name of the pipeline", func() {
+					source := concourse.Source{
+						SpinnakerAPI:         spinnakerServer.URL(),
+						SpinnakerApplication: applicationName,
+						SpinnakerPipelineID:  "3f5a9c2e",
+						X509Cert:             serverCert,
+						X509Key:              serverKey,
+					}
+					client, err := spinnaker.NewClient(context.Background(), source)
 
 					Expect(err).ToNot(HaveOccurred())
+					Expect(client.Source().SpinnakerPipeline).To(Equal("renamed_pipeline"))
+					Expect(spinnakerServer.ReceivedRequests()).To(HaveLen(2))
+				})
+
+				It("returns an error when no pipeline has the id", func() {
+					source := concourse.Source{
+						SpinnakerAPI:         spinnakerServer.URL(),
+						SpinnakerApplication: applicationName,
+						SpinnakerPipelineID:  "deleted",
+						X509Cert:             serverCert,
+						X509Key:              serverKey,
+					}
+					_, err := spinnaker.NewClient(context.Background(), source)
+
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(Equal("spinnaker pipeline with id deleted not found"))
+					Expect(errors.Is(err, spinnaker.ErrPipelineNotFound)).To(BeTrue())
 				})
 			})
 		})
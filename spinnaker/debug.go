@@ -0,0 +1,106 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strings"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+const redacted = "[REDACTED]"
+
+// maxDebugBodySize is how much of the body of a failed response is traced
+const maxDebugBodySize = 1024
+
+var (
+	sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Vault-Token", "X-Amz-Security-Token"}
+
+	sensitiveFields = []string{
+		"password", "client_secret", "secret_id", "client_token", "access_token", "refresh_token", "id_token",
+		"assertion", "SAMLResponse", "private_key", "bearer_token", "api_key", "oauth2_client_secret",
+		"oidc_client_secret", "oidc_refresh_token", "spinnaker_x509_key", "x509_key_password", "gcp_service_account_key",
+		"saml_assertion", "kerberos_keytab",
+		"SecretAccessKey", "SessionToken", "Token",
+	}
+
+	privateKeyPattern = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)
+	jsonFieldPattern  = regexp.MustCompile(`(?i)("(?:` + strings.Join(sensitiveFields, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	formFieldPattern  = regexp.MustCompile(`(?i)(^|[&\n])((?:` + strings.Join(sensitiveFields, "|") + `)=)[^&\s]*`)
+	xmlFieldPattern   = regexp.MustCompile(`(?i)(<(` + strings.Join(sensitiveFields, "|") + `)>)[^<]*(</)`)
+)
+
+// debugTransport traces every request and response to stderr, with
+// credentials redacted
+type debugTransport struct {
+	next    http.RoundTripper
+	headers []string
+}
+
+func newDebugTransport(next http.RoundTripper, source concourse.Source) http.RoundTripper {
+	headers := sensitiveHeaders
+	if source.APIKeyHeader != "" {
+		headers = append([]string{source.APIKeyHeader}, headers...)
+	} else {
+		headers = append([]string{defaultAPIKeyHeader}, headers...)
+	}
+	return &debugTransport{next: next, headers: headers}
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		concourse.Sayf("[debug] request:\n%s\n", t.redact(string(dump)))
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		concourse.Sayf("[debug] request failed: %s\n", err)
+		return res, err
+	}
+
+	if dump, err := t.dumpResponse(res); err == nil {
+		concourse.Sayf("[debug] response:\n%s\n", dump)
+	}
+	return res, nil
+}
+
+// dumpResponse leaves out the bodies of successful responses, which hold
+// whole executions whose stage contexts often embed secrets that only the
+// get step knows to redact. The bodies of failed ones tell why they failed,
+// so their start is kept.
+func (t *debugTransport) dumpResponse(res *http.Response) (string, error) {
+	dump, err := httputil.DumpResponse(res, res.StatusCode >= 400)
+	if err != nil {
+		return "", err
+	}
+	redactedDump := t.redact(string(dump))
+
+	headerEnd := strings.Index(redactedDump, "\r\n\r\n") + len("\r\n\r\n")
+	if headerEnd < len("\r\n\r\n") || len(redactedDump)-headerEnd <= maxDebugBodySize {
+		return redactedDump, nil
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", redactedDump[:headerEnd+maxDebugBodySize], len(redactedDump)-headerEnd-maxDebugBodySize), nil
+}
+
+func (t *debugTransport) redact(dump string) string {
+	for _, header := range t.headers {
+		headerPattern := regexp.MustCompile(`(?mi)^(` + regexp.QuoteMeta(header) + `:)[^\r\n]*`)
+		dump = headerPattern.ReplaceAllString(dump, "${1} "+redacted)
+	}
+	dump = privateKeyPattern.ReplaceAllString(dump, redacted)
+	dump = jsonFieldPattern.ReplaceAllString(dump, `${1}"`+redacted+`"`)
+	dump = formFieldPattern.ReplaceAllString(dump, "${1}${2}"+redacted)
+	dump = xmlFieldPattern.ReplaceAllString(dump, "${1}"+redacted+"${3}")
+	return dump
+}
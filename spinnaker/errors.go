@@ -0,0 +1,87 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+// errors returned by SpinClient, check for them with errors.Is
+var (
+	ErrApplicationNotFound       = errors.New("spinnaker application not found")
+	ErrPipelineNotFound          = errors.New("spinnaker pipeline not found")
+	ErrPipelineExecutionNotFound = errors.New("pipeline execution not found")
+	ErrUnauthorized              = errors.New("spinnaker api rejected the credentials")
+	ErrRateLimited               = errors.New("spinnaker api rate limit exceeded")
+	ErrSpinnakerUnavailable      = errors.New("spinnaker unavailable")
+)
+
+// APIError is returned when Gate responds with an unexpected error status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("spinnaker api responded with status code: %d, body: %s", e.StatusCode, e.Body)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Temporary reports whether the request may succeed if it is tried again
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// IsTemporary reports whether err is likely to go away by itself because Gate
+// was unreachable, overloaded or briefly failing
+func IsTemporary(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var netErr net.Error
+	return errors.Is(err, ErrSpinnakerUnavailable) || errors.As(err, &netErr)
+}
+
+func newAPIError(res *http.Response) error {
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	return &APIError{StatusCode: res.StatusCode, Body: string(body)}
+}
+
+// notFoundError keeps the name of what was missing in the message while
+// matching one of the not found errors
+type notFoundError struct {
+	err     error
+	message string
+}
+
+func (e *notFoundError) Error() string {
+	return e.message
+}
+
+func (e *notFoundError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,57 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+var _ = Describe("APIError", func() {
+	It("keeps the status code and body in the message", func() {
+		err := &spinnaker.APIError{StatusCode: 500, Body: "boom"}
+		Expect(err.Error()).To(Equal("spinnaker api responded with status code: 500, body: boom"))
+	})
+
+	It("matches ErrUnauthorized for 401 and 403 responses", func() {
+		Expect(errors.Is(&spinnaker.APIError{StatusCode: 401}, spinnaker.ErrUnauthorized)).To(BeTrue())
+		Expect(errors.Is(&spinnaker.APIError{StatusCode: 403}, spinnaker.ErrUnauthorized)).To(BeTrue())
+		Expect(errors.Is(&spinnaker.APIError{StatusCode: 400}, spinnaker.ErrUnauthorized)).To(BeFalse())
+	})
+
+	It("matches ErrRateLimited for 429 responses", func() {
+		Expect(errors.Is(&spinnaker.APIError{StatusCode: 429}, spinnaker.ErrRateLimited)).To(BeTrue())
+		Expect(errors.Is(&spinnaker.APIError{StatusCode: 503}, spinnaker.ErrRateLimited)).To(BeFalse())
+	})
+
+	It("is temporary for rate limited and server errors", func() {
+		Expect((&spinnaker.APIError{StatusCode: 429}).Temporary()).To(BeTrue())
+		Expect((&spinnaker.APIError{StatusCode: 502}).Temporary()).To(BeTrue())
+		Expect((&spinnaker.APIError{StatusCode: 404}).Temporary()).To(BeFalse())
+	})
+})
+
+var _ = Describe("IsTemporary", func() {
+	It("is true when Gate is unreachable, unavailable or failing", func() {
+		Expect(spinnaker.IsTemporary(&net.OpError{Op: "dial", Err: errors.New("connection refused")})).To(BeTrue())
+		Expect(spinnaker.IsTemporary(fmt.Errorf("%w: open", spinnaker.ErrSpinnakerUnavailable))).To(BeTrue())
+		Expect(spinnaker.IsTemporary(&spinnaker.APIError{StatusCode: 503})).To(BeTrue())
+	})
+
+	It("is false for errors that need fixing", func() {
+		Expect(spinnaker.IsTemporary(&spinnaker.APIError{StatusCode: 401})).To(BeFalse())
+		Expect(spinnaker.IsTemporary(spinnaker.ErrPipelineNotFound)).To(BeFalse())
+	})
+})
@@ -0,0 +1,59 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+// eventIDPrefix is shared by the eventIds of every trigger sent by resources
+// configured with the same API, application and pipeline
+func eventIDPrefix(source concourse.Source) string {
+	sum := sha256.Sum256([]byte(source.SpinnakerAPI + "/" + source.SpinnakerApplication + "/" + source.SpinnakerPipeline))
+	return fmt.Sprintf("spinnaker-resource-%x-", sum[:4])
+}
+
+// NewEventID returns an eventId to tag a trigger with, so check can tell the
+// executions this resource started from the ones started by anything else
+func NewEventID(source concourse.Source) (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return eventIDPrefix(source) + hex.EncodeToString(random), nil
+}
+
+// BuildEventID returns the eventId of every trigger sent by the same build,
+// so a retried put step can find the execution it already started. It is
+// tagged like the ones of NewEventID.
+func BuildEventID(source concourse.Source, build string) string {
+	sum := sha256.Sum256([]byte(build))
+	return eventIDPrefix(source) + "build-" + hex.EncodeToString(sum[:8])
+}
+
+// TaggedEventID tags an eventId chosen by the user like the ones of
+// NewEventID, unless it already is, so check still emits its execution
+func TaggedEventID(source concourse.Source, eventID string) string {
+	if strings.HasPrefix(eventID, eventIDPrefix(source)) {
+		return eventID
+	}
+	return eventIDPrefix(source) + eventID
+}
+
+// TriggeredBy reports whether the execution was tagged by a resource with this source
+func TriggeredBy(source concourse.Source, execution PipelineExecution) bool {
+	return strings.HasPrefix(execution.Trigger.EventID, eventIDPrefix(source))
+}
@@ -0,0 +1,214 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+const (
+	googleTokenURI   = "https://oauth2.googleapis.com/token"
+	jwtBearerGrant   = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	iapTokenLifetime = time.Hour
+)
+
+type gcpServiceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// IAPAuthClient mints Google-signed ID tokens for the IAP OAuth client from a
+// service account key and sends them as bearer tokens
+type IAPAuthClient struct {
+	client      *http.Client
+	email       string
+	keyID       string
+	key         *rsa.PrivateKey
+	tokenURI    string
+	iapClientID string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func NewIAPAuthClient(source concourse.Source) (*IAPAuthClient, error) {
+	if source.GCPServiceAccountKey == "" || source.IAPClientID == "" {
+		return nil, fmt.Errorf("gcp_service_account_key and iap_client_id must be set when using the %s auth method", AuthMethodIAP)
+	}
+
+	var saKey gcpServiceAccountKey
+	err := json.Unmarshal([]byte(source.GCPServiceAccountKey), &saKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gcp_service_account_key: %s", err)
+	}
+	if saKey.Type != "service_account" || saKey.ClientEmail == "" {
+		return nil, fmt.Errorf("invalid gcp_service_account_key: not a service account key")
+	}
+
+	key, err := parseRSAPrivateKey([]byte(saKey.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gcp_service_account_key: %s", err)
+	}
+
+	tokenURI := saKey.TokenURI
+	if tokenURI == "" {
+		tokenURI = googleTokenURI
+	}
+
+	client, err := newHTTPClient(source)
+	if err != nil {
+		return nil, err
+	}
+	return &IAPAuthClient{
+		client:      client,
+		email:       saKey.ClientEmail,
+		keyID:       saKey.PrivateKeyID,
+		key:         key,
+		tokenURI:    tokenURI,
+		iapClientID: source.IAPClientID,
+	}, nil
+}
+
+func (c *IAPAuthClient) Do(req *http.Request) (*http.Response, error) {
+	token, err := c.idToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return c.client.Do(req)
+}
+
+func (c *IAPAuthClient) idToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+
+	now := time.Now()
+	assertion, err := signJWT(c.key, c.keyID, map[string]interface{}{
+		"iss":             c.email,
+		"sub":             c.email,
+		"aud":             c.tokenURI,
+		"iat":             now.Unix(),
+		"exp":             now.Add(iapTokenLifetime).Unix(),
+		"target_audience": c.iapClientID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", jwtBearerGrant)
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	token, err := requestToken(c.client, req)
+	if err != nil {
+		return "", err
+	}
+	if token.IDToken == "" {
+		return "", fmt.Errorf("token endpoint response did not contain an id_token")
+	}
+
+	c.token = token.IDToken
+	c.expiry = jwtExpiry(token.IDToken, now.Add(iapTokenLifetime)).Add(-tokenExpiryLeeway)
+	return c.token, nil
+}
+
+func parseRSAPrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+func signJWT(key *rsa.PrivateKey, keyID string, claims map[string]interface{}) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// jwtExpiry reads the exp claim of a token without verifying it, falling back
+// to the given time when the token can't be decoded
+func jwtExpiry(token string, fallback time.Time) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fallback
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fallback
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return fallback
+	}
+	return time.Unix(claims.Exp, 0)
+}
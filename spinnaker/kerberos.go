@@ -0,0 +1,95 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+const defaultKrb5ConfPath = "/etc/krb5.conf"
+
+// KerberosAuthClient answers Gate's Negotiate challenges with SPNEGO tokens
+// for a service ticket obtained from a keytab or credentials cache
+type KerberosAuthClient struct {
+	client *spnego.Client
+}
+
+func NewKerberosAuthClient(source concourse.Source) (*KerberosAuthClient, error) {
+	if source.KerberosKeytab == "" && source.KerberosCCachePath == "" {
+		return nil, fmt.Errorf("kerberos_keytab or kerberos_ccache_path must be set when using the %s auth method", AuthMethodKerberos)
+	}
+
+	var krb5Conf *config.Config
+	var err error
+	if source.KerberosKrb5Conf != "" {
+		krb5Conf, err = config.NewFromString(source.KerberosKrb5Conf)
+	} else {
+		krb5Conf, err = config.Load(defaultKrb5ConfPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading krb5 config: %s", err)
+	}
+
+	var krb5Client *client.Client
+	if source.KerberosKeytab != "" {
+		principal := strings.SplitN(source.KerberosPrincipal, "@", 2)
+		if len(principal) != 2 {
+			return nil, fmt.Errorf("kerberos_principal must be of the form user@REALM when kerberos_keytab is set")
+		}
+
+		keytabBytes, err := base64.StdEncoding.DecodeString(source.KerberosKeytab)
+		if err != nil {
+			return nil, fmt.Errorf("kerberos_keytab must be base64 encoded: %s", err)
+		}
+		kt := keytab.New()
+		err = kt.Unmarshal(keytabBytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing kerberos_keytab: %s", err)
+		}
+
+		krb5Client = client.NewWithKeytab(principal[0], principal[1], kt, krb5Conf, client.DisablePAFXFAST(true))
+		err = krb5Client.Login()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		ccache, err := credentials.LoadCCache(source.KerberosCCachePath)
+		if err != nil {
+			return nil, fmt.Errorf("loading kerberos_ccache_path: %s", err)
+		}
+		krb5Client, err = client.NewFromCCache(ccache, krb5Conf, client.DisablePAFXFAST(true))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	httpClient, err := newHTTPClient(source)
+	if err != nil {
+		return nil, err
+	}
+	return &KerberosAuthClient{
+		client: spnego.NewClient(krb5Client, httpClient, source.KerberosSPN),
+	}, nil
+}
+
+func (c *KerberosAuthClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req)
+}
@@ -9,9 +9,74 @@ Unless required by applicable law or agreed to in writing, software distributed
 */
 package spinnaker
 
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
 type PipelineExecution struct {
-	ID        string `json:"id"`
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Application string  `json:"application"`
+	BuildTime   uint64  `json:"buildTime"`
+	StartTime   uint64  `json:"startTime"`
+	EndTime     uint64  `json:"endTime"`
+	Status      string  `json:"status"`
+	Canceled    bool    `json:"canceled"`
+	Trigger     Trigger `json:"trigger"`
+	Stages      []Stage `json:"stages"`
+}
+
+// Trigger describes what started a pipeline execution
+type Trigger struct {
+	Type       string                 `json:"type"`
+	User       string                 `json:"user"`
+	EventID    string                 `json:"eventId"`
+	Parameters map[string]interface{} `json:"parameters"`
+	Artifacts  []Artifact             `json:"artifacts"`
+}
+
+// Artifact is an artifact a trigger brought in, such as a docker image
+type Artifact struct {
+	Type      string `json:"type"`
 	Name      string `json:"name"`
-	BuildTime uint64 `json:"buildTime"`
-	Status    string `json:"status"`
+	Version   string `json:"version"`
+	Reference string `json:"reference"`
+}
+
+type Stage struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// ActiveStatus reports whether an execution with the status hasn't ended yet
+func ActiveStatus(status string) bool {
+	for _, active := range []string{"NOT_STARTED", "RUNNING", "PAUSED", "SUSPENDED", "BUFFERED"} {
+		if strings.EqualFold(status, active) {
+			return true
+		}
+	}
+	return false
+}
+
+// VersionFor returns the version of an execution watched with the source, so
+// that check and put emit the same one for it
+func VersionFor(execution PipelineExecution, source concourse.Source) concourse.Version {
+	version := concourse.Version{
+		Ref:       execution.ID,
+		Status:    execution.Status,
+		BuildTime: strconv.FormatUint(execution.BuildTime, 10),
+	}
+	//executions of several pipelines are merged into one stream, so tell them apart
+	if len(source.SpinnakerPipelines) > 0 || source.SpinnakerPipelineRegex != "" {
+		version.Pipeline = execution.Name
+	}
+	if len(source.SpinnakerApplications) > 0 || source.SpinnakerAppRegex != "" {
+		version.Application = execution.Application
+	}
+	return version
 }
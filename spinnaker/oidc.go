@@ -0,0 +1,148 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+// OIDCAuthClient exchanges a refresh token for access tokens at the issuer's
+// token endpoint, refreshing again whenever the access token expires
+type OIDCAuthClient struct {
+	client       *http.Client
+	issuerURL    string
+	clientID     string
+	clientSecret string
+
+	mu            sync.Mutex
+	tokenEndpoint string
+	refreshToken  string
+	token         string
+	expiry        time.Time
+}
+
+func NewOIDCAuthClient(source concourse.Source) (*OIDCAuthClient, error) {
+	if source.OIDCIssuerURL == "" || source.OIDCClientID == "" || source.OIDCRefreshToken == "" {
+		return nil, fmt.Errorf("oidc_issuer_url, oidc_client_id and oidc_refresh_token must be set when using the %s auth method", AuthMethodOIDC)
+	}
+
+	client, err := newHTTPClient(source)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCAuthClient{
+		client:       client,
+		issuerURL:    strings.TrimSuffix(source.OIDCIssuerURL, "/"),
+		clientID:     source.OIDCClientID,
+		clientSecret: source.OIDCClientSecret,
+		refreshToken: source.OIDCRefreshToken,
+	}, nil
+}
+
+func (c *OIDCAuthClient) Do(req *http.Request) (*http.Response, error) {
+	token, err := c.accessToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return c.client.Do(req)
+}
+
+func (c *OIDCAuthClient) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && (c.expiry.IsZero() || time.Now().Before(c.expiry)) {
+		return c.token, nil
+	}
+
+	if c.tokenEndpoint == "" {
+		endpoint, err := c.discoverTokenEndpoint(ctx)
+		if err != nil {
+			return "", err
+		}
+		c.tokenEndpoint = endpoint
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", c.refreshToken)
+	form.Set("client_id", c.clientID)
+	if c.clientSecret != "" {
+		form.Set("client_secret", c.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	token, err := requestToken(c.client, req)
+	if err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint response did not contain an access_token")
+	}
+
+	c.token = token.AccessToken
+	//some issuers rotate the refresh token on every use
+	if token.RefreshToken != "" {
+		c.refreshToken = token.RefreshToken
+	}
+	c.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		c.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryLeeway)
+	}
+	return c.token, nil
+}
+
+func (c *OIDCAuthClient) discoverTokenEndpoint(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.issuerURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode >= 400 {
+		return "", fmt.Errorf("oidc discovery responded with status code: %d, body: %s", res.StatusCode, string(body))
+	}
+
+	var configuration struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	err = json.Unmarshal(body, &configuration)
+	if err != nil {
+		return "", err
+	}
+	if configuration.TokenEndpoint == "" {
+		return "", fmt.Errorf("oidc discovery document for %s did not contain a token_endpoint", c.issuerURL)
+	}
+	return configuration.TokenEndpoint, nil
+}
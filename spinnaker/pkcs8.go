@@ -0,0 +1,56 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/youmark/pkcs8"
+)
+
+var errIncorrectKeyPassword = errors.New("x509 key could not be decrypted, x509_key_password may be incorrect")
+
+// decryptPrivateKeyPEM decrypts a passphrase protected PEM key, either a
+// PKCS#8 "ENCRYPTED PRIVATE KEY" or a legacy encrypted PKCS#1 key, and returns
+// it re-encoded as an unencrypted PEM block
+func decryptPrivateKeyPEM(keyPEM []byte, password string) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("x509 key is not PEM encoded")
+	}
+
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+		//pkcs8 doesn't export its errors
+		if err != nil && err.Error() == "pkcs8: incorrect password" {
+			return nil, errIncorrectKeyPassword
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing encrypted x509 key: %s", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+
+	if x509.IsEncryptedPEMBlock(block) {
+		der, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return nil, errIncorrectKeyPassword
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+	}
+
+	return nil, fmt.Errorf("x509_key_password is set but the x509 key is not encrypted")
+}
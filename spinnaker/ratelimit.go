@@ -0,0 +1,97 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+// RateLimitClient spaces requests out so no more than rate_limit requests per
+// second are sent to Gate. Like the state of the circuit breaker, the schedule
+// is kept in a file, so the steps run in the same container share it.
+type RateLimitClient struct {
+	client    AuthHttpClient
+	interval  time.Duration
+	stateFile string
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+type rateLimitState struct {
+	Next time.Time `json:"next"`
+}
+
+func NewRateLimitClient(client AuthHttpClient, source concourse.Source) (AuthHttpClient, error) {
+	if source.RateLimit < 0 {
+		return nil, fmt.Errorf("rate_limit must not be negative")
+	} else if source.RateLimit == 0 {
+		return client, nil
+	}
+
+	sum := sha256.Sum256([]byte(source.SpinnakerAPI))
+	return &RateLimitClient{
+		client:    client,
+		interval:  time.Duration(float64(time.Second) / source.RateLimit),
+		stateFile: filepath.Join(os.TempDir(), fmt.Sprintf("spinnaker-resource-ratelimit-%x.json", sum[:8])),
+	}, nil
+}
+
+func (c *RateLimitClient) Do(req *http.Request) (*http.Response, error) {
+	select {
+	case <-time.After(c.reserve()):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return c.client.Do(req)
+}
+
+// reserve claims the next free slot and returns how long to wait for it. The
+// file is locked while the slot is claimed, so concurrent steps take turns.
+func (c *RateLimitClient) reserve() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	//the limiter is best effort, without its file only the requests of the step are spaced out
+	file, err := os.OpenFile(c.stateFile, os.O_RDWR|os.O_CREATE, 0600)
+	if err == nil {
+		defer file.Close()
+		if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err == nil {
+			var state rateLimitState
+			if json.NewDecoder(file).Decode(&state) == nil && state.Next.After(c.next) {
+				c.next = state.Next
+			}
+		}
+	}
+
+	now := time.Now()
+	if c.next.Before(now) {
+		c.next = now
+	}
+	wait := c.next.Sub(now)
+	c.next = c.next.Add(c.interval)
+
+	if err == nil && file.Truncate(0) == nil {
+		if _, err := file.Seek(0, 0); err == nil {
+			json.NewEncoder(file).Encode(rateLimitState{Next: c.next})
+		}
+	}
+	return wait
+}
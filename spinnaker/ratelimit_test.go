@@ -0,0 +1,110 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+var _ = Describe("RateLimitClient", func() {
+	var (
+		server   *ghttp.Server
+		source   concourse.Source
+		stateDir string
+		tmpDir   string
+	)
+
+	BeforeEach(func() {
+		var err error
+		stateDir, err = ioutil.TempDir("", "ratelimit")
+		Expect(err).ToNot(HaveOccurred())
+		tmpDir = os.Getenv("TMPDIR")
+		os.Setenv("TMPDIR", stateDir)
+
+		server = ghttp.NewServer()
+		server.AllowUnhandledRequests = true
+		source = concourse.Source{
+			SpinnakerAPI: server.URL(),
+			AuthMethod:   spinnaker.AuthMethodToken,
+			BearerToken:  "some-service-token",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.Setenv("TMPDIR", tmpDir)
+		os.RemoveAll(stateDir)
+	})
+
+	It("spaces requests out to the configured rate", func() {
+		source.RateLimit = 20
+		authClient, err := spinnaker.NewAuthHttpClient(context.Background(), source)
+		Expect(err).ToNot(HaveOccurred())
+		client, err := spinnaker.NewRateLimitClient(authClient, source)
+		Expect(err).ToNot(HaveOccurred())
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			req, err := http.NewRequest("GET", server.URL()+"/applications/foo", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		Expect(server.ReceivedRequests()).To(HaveLen(5))
+	})
+
+	It("shares the schedule with the other steps in the container", func() {
+		source.RateLimit = 20
+		var clients []spinnaker.AuthHttpClient
+		for i := 0; i < 2; i++ {
+			authClient, err := spinnaker.NewAuthHttpClient(context.Background(), source)
+			Expect(err).ToNot(HaveOccurred())
+			client, err := spinnaker.NewRateLimitClient(authClient, source)
+			Expect(err).ToNot(HaveOccurred())
+			clients = append(clients, client)
+		}
+
+		start := time.Now()
+		for i := 0; i < 6; i++ {
+			req, err := http.NewRequest("GET", server.URL()+"/applications/foo", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = clients[i%2].Do(req)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(time.Since(start)).To(BeNumerically(">=", 250*time.Millisecond))
+		Expect(server.ReceivedRequests()).To(HaveLen(6))
+	})
+
+	It("does not limit requests when no rate is configured", func() {
+		authClient, err := spinnaker.NewAuthHttpClient(context.Background(), source)
+		Expect(err).ToNot(HaveOccurred())
+		client, err := spinnaker.NewRateLimitClient(authClient, source)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client).To(BeIdenticalTo(authClient))
+	})
+
+	It("returns an error when the rate is negative", func() {
+		source.RateLimit = -1
+		_, err := spinnaker.NewRateLimitClient(nil, source)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("rate_limit must not be negative"))
+	})
+})
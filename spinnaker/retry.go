@@ -0,0 +1,142 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBackoff     = 1 * time.Second
+	maxRetryBackoff         = 30 * time.Second
+)
+
+var defaultRetryStatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// RetryClient retries requests that fail with a network error or a retryable
+// status code, doubling the wait between each attempt. Requests that change
+// something are only retried when they carry an eventId, since Gate may have
+// acted on the attempt whose answer got lost.
+type RetryClient struct {
+	client      AuthHttpClient
+	maxAttempts int
+	backoff     time.Duration
+	statusCodes map[int]bool
+}
+
+func NewRetryClient(client AuthHttpClient, source concourse.Source) (*RetryClient, error) {
+	maxAttempts := source.RetryMaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	} else if maxAttempts < 0 {
+		return nil, fmt.Errorf("retry_max_attempts must be at least 1")
+	}
+
+	backoff := defaultRetryBackoff
+	if source.RetryBackoff != "" {
+		var err error
+		backoff, err = time.ParseDuration(source.RetryBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry_backoff: %s", err)
+		}
+	}
+
+	codes := source.RetryStatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryStatusCodes
+	}
+	statusCodes := map[int]bool{}
+	for _, code := range codes {
+		statusCodes[code] = true
+	}
+
+	return &RetryClient{
+		client:      client,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		statusCodes: statusCodes,
+	}, nil
+}
+
+func (c *RetryClient) Do(req *http.Request) (*http.Response, error) {
+	wait := c.backoff
+	replayable := replayableRequest(req)
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 {
+			var err error
+			attemptReq, err = rewindRequest(req)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		res, err := c.client.Do(attemptReq)
+		if !replayable || attempt >= c.maxAttempts || req.Context().Err() != nil || !c.retryable(res, err) {
+			return res, err
+		}
+		if res != nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		wait *= 2
+		if wait > maxRetryBackoff {
+			wait = maxRetryBackoff
+		}
+	}
+}
+
+func (c *RetryClient) retryable(res *http.Response, err error) bool {
+	if err != nil {
+		//only errors talking to Gate are transient, auth misconfiguration is not
+		var netErr net.Error
+		return errors.As(err, &netErr)
+	}
+	return c.statusCodes[res.StatusCode]
+}
+
+// replayableRequest reports whether req can be sent again: reads can, and so
+// can triggers tagged with an eventId, which a duplicate execution can be told
+// apart by
+func replayableRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return true
+	}
+	if req.GetBody == nil {
+		return false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	defer body.Close()
+	var trigger struct {
+		EventID string `json:"eventId"`
+	}
+	return json.NewDecoder(body).Decode(&trigger) == nil && trigger.EventID != ""
+}
@@ -0,0 +1,157 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+	"github.com/pivotal-cf/spinnaker-resource/spinnaker"
+)
+
+var _ = Describe("RetryClient", func() {
+	var (
+		server *ghttp.Server
+		source concourse.Source
+		client *spinnaker.RetryClient
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		source = concourse.Source{
+			AuthMethod:   spinnaker.AuthMethodToken,
+			BearerToken:  "some-service-token",
+			RetryBackoff: "1ms",
+		}
+	})
+
+	JustBeforeEach(func() {
+		authClient, err := spinnaker.NewAuthHttpClient(context.Background(), source)
+		Expect(err).ToNot(HaveOccurred())
+		client, err = spinnaker.NewRetryClient(authClient, source)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("retries requests that fail with a retryable status code", func() {
+		server.AppendHandlers(
+			ghttp.RespondWith(502, "bad gateway"),
+			ghttp.RespondWith(503, "unavailable"),
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/applications/foo"),
+				ghttp.RespondWith(200, "{}"),
+			),
+		)
+
+		req, err := http.NewRequest("GET", server.URL()+"/applications/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		res, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(server.ReceivedRequests()).To(HaveLen(3))
+	})
+
+	It("does not retry a trigger that Gate may have accepted", func() {
+		server.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/pipelines/foo/bar"),
+				ghttp.RespondWith(504, "gateway timeout"),
+			),
+		)
+
+		req, err := http.NewRequest("POST", server.URL()+"/pipelines/foo/bar", bytes.NewBufferString(`{"type":"concourse-resource"}`))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(504))
+		Expect(server.ReceivedRequests()).To(HaveLen(1))
+	})
+
+	It("retries triggers tagged with an eventId", func() {
+		server.AppendHandlers(
+			ghttp.RespondWith(502, "bad gateway"),
+			ghttp.RespondWith(503, "unavailable"),
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/pipelines/foo/bar"),
+				ghttp.VerifyBody([]byte(`{"type":"concourse-resource","eventId":"build-42"}`)),
+				ghttp.RespondWith(202, "{}"),
+			),
+		)
+
+		req, err := http.NewRequest("POST", server.URL()+"/pipelines/foo/bar", bytes.NewBufferString(`{"type":"concourse-resource","eventId":"build-42"}`))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(202))
+		Expect(server.ReceivedRequests()).To(HaveLen(3))
+	})
+
+	It("returns the last response once the attempts are used up", func() {
+		server.AppendHandlers(
+			ghttp.RespondWith(503, "unavailable"),
+			ghttp.RespondWith(503, "unavailable"),
+			ghttp.RespondWith(503, "still unavailable"),
+		)
+
+		req, err := http.NewRequest("GET", server.URL()+"/applications/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		res, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(503))
+		Expect(server.ReceivedRequests()).To(HaveLen(3))
+	})
+
+	It("does not retry other status codes", func() {
+		server.AppendHandlers(ghttp.RespondWith(500, "boom"))
+
+		req, err := http.NewRequest("GET", server.URL()+"/applications/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		res, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(500))
+		Expect(server.ReceivedRequests()).To(HaveLen(1))
+	})
+
+	Context("when the retry settings are configured", func() {
+		BeforeEach(func() {
+			source.RetryMaxAttempts = 2
+			source.RetryStatusCodes = []int{500}
+		})
+
+		It("uses the configured attempts and status codes", func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(500, "boom"),
+				ghttp.RespondWith(500, "boom"),
+			)
+
+			req, err := http.NewRequest("GET", server.URL()+"/applications/foo", nil)
+			Expect(err).ToNot(HaveOccurred())
+			res, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(500))
+			Expect(server.ReceivedRequests()).To(HaveLen(2))
+		})
+	})
+
+	It("returns an error when the backoff is not a duration", func() {
+		source.RetryBackoff = "soon"
+		_, err := spinnaker.NewRetryClient(nil, source)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("invalid retry_backoff"))
+	})
+})
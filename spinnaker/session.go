@@ -0,0 +1,185 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+// SessionAuthClient logs in to Gate once and keeps the session cookie, logging
+// in again whenever Gate reports the session has expired
+type SessionAuthClient struct {
+	client      *http.Client
+	loginClient *http.Client
+	login       func(ctx context.Context, loginClient *http.Client) error
+
+	mu       sync.Mutex
+	loggedIn bool
+}
+
+func newSessionAuthClient(source concourse.Source, login func(ctx context.Context, loginClient *http.Client) error) (*SessionAuthClient, error) {
+	client, err := newHTTPClient(source)
+	if err != nil {
+		return nil, err
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Jar = jar
+
+	//the login endpoints redirect to the UI on success, which we don't want to follow
+	loginClient := &http.Client{
+		Transport: client.Transport,
+		Timeout:   client.Timeout,
+		Jar:       jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &SessionAuthClient{
+		client:      client,
+		loginClient: loginClient,
+		login:       login,
+	}, nil
+}
+
+// NewLDAPAuthClient logs in with a username and password through Gate's form login
+func NewLDAPAuthClient(source concourse.Source) (*SessionAuthClient, error) {
+	if source.Username == "" || source.Password == "" {
+		return nil, fmt.Errorf("username and password must be set when using the %s auth method", AuthMethodLDAP)
+	}
+
+	loginURL := strings.TrimSuffix(source.SpinnakerAPI, "/") + "/login"
+	form := url.Values{}
+	form.Set("username", source.Username)
+	form.Set("password", source.Password)
+
+	return newSessionAuthClient(source, func(ctx context.Context, loginClient *http.Client) error {
+		return postLoginForm(ctx, loginClient, loginURL, form, AuthMethodLDAP)
+	})
+}
+
+// NewSAMLAuthClient logs in by posting a SAML response, already obtained from
+// the identity provider, to Gate's assertion consumer endpoint. Assertions are
+// only accepted once, so a session that expires can't be renewed.
+func NewSAMLAuthClient(source concourse.Source) (*SessionAuthClient, error) {
+	if source.SAMLAssertion == "" {
+		return nil, fmt.Errorf("saml_assertion must be set when using the %s auth method", AuthMethodSAML)
+	}
+
+	loginURL := strings.TrimSuffix(source.SpinnakerAPI, "/") + "/saml/SSO"
+	form := url.Values{}
+	form.Set("SAMLResponse", source.SAMLAssertion)
+
+	used := false
+	return newSessionAuthClient(source, func(ctx context.Context, loginClient *http.Client) error {
+		if used {
+			return fmt.Errorf("spinnaker %s session expired and the saml_assertion can only be used once, obtain a fresh one for the step", AuthMethodSAML)
+		}
+		if err := postLoginForm(ctx, loginClient, loginURL, form, AuthMethodSAML); err != nil {
+			return err
+		}
+		used = true
+		return nil
+	})
+}
+
+func (c *SessionAuthClient) Do(req *http.Request) (*http.Response, error) {
+	if err := c.ensureLoggedIn(req.Context(), false); err != nil {
+		return nil, err
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	retry, err := rewindRequest(req)
+	if err != nil {
+		return res, nil
+	}
+	//the cookie jar added the expired session to the original request
+	retry.Header.Del("Cookie")
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	if err := c.ensureLoggedIn(req.Context(), true); err != nil {
+		return nil, err
+	}
+	return c.client.Do(retry)
+}
+
+func (c *SessionAuthClient) ensureLoggedIn(ctx context.Context, force bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.loggedIn && !force {
+		return nil
+	}
+	c.loggedIn = false
+
+	if err := c.login(ctx, c.loginClient); err != nil {
+		return err
+	}
+	c.loggedIn = true
+	return nil
+}
+
+func postLoginForm(ctx context.Context, loginClient *http.Client, loginURL string, form url.Values, authMethod string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", loginURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := loginClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("spinnaker %s login failed with status code: %d, body: %s", authMethod, res.StatusCode, string(body))
+	}
+	if strings.Contains(res.Header.Get("Location"), "error") {
+		return fmt.Errorf("spinnaker %s login failed, check the configured credentials", authMethod)
+	}
+	return nil
+}
+
+// rewindRequest returns a copy of req that can be sent again, with a fresh body
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	retry := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retry, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("request body can not be replayed")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	retry.Body = body
+	return retry, nil
+}
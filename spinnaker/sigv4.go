@@ -0,0 +1,138 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+const defaultAWSService = "execute-api"
+
+// SigV4AuthClient signs every request with AWS Signature Version 4 using the
+// credentials of the AWS SDK's default chain: the environment, IRSA web
+// identity, ECS or EC2 instance metadata. The credentials are fetched with
+// the HTTP client of the source.
+type SigV4AuthClient struct {
+	client      *http.Client
+	region      string
+	service     string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+}
+
+func NewSigV4AuthClient(source concourse.Source) (*SigV4AuthClient, error) {
+	if source.AWSRegion == "" {
+		return nil, fmt.Errorf("aws_region must be set when using the %s auth method", AuthMethodSigV4)
+	}
+	service := source.AWSService
+	if service == "" {
+		service = defaultAWSService
+	}
+
+	client, err := newHTTPClient(source)
+	if err != nil {
+		return nil, err
+	}
+	awsClient, err := newAWSHTTPClient(source)
+	if err != nil {
+		return nil, err
+	}
+	//loading the config only reads the environment, the credentials are
+	//retrieved with the context of the first request
+	awsConfig, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(source.AWSRegion), config.WithHTTPClient(awsClient))
+	if err != nil {
+		return nil, err
+	}
+	return &SigV4AuthClient{
+		client:      client,
+		region:      source.AWSRegion,
+		service:     service,
+		credentials: awsConfig.Credentials,
+		signer:      v4.NewSigner(),
+	}, nil
+}
+
+// newAWSHTTPClient returns the client the credentials are retrieved with,
+// connecting like the one reaching Gate. The SDK adds AWS_CA_BUNDLE to the
+// transport itself, which it can only do for clients it builds.
+func newAWSHTTPClient(source concourse.Source) (*awshttp.BuildableClient, error) {
+	tr, err := newTransport(source)
+	if err != nil {
+		return nil, err
+	}
+	requestTimeout, err := parseTimeout(source.RequestTimeout, "request_timeout", defaultRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return awshttp.NewBuildableClient().WithTimeout(requestTimeout).WithTransportOptions(func(awsTransport *http.Transport) {
+		awsTransport.Proxy = tr.Proxy
+		awsTransport.TLSClientConfig = tr.TLSClientConfig
+		awsTransport.DialContext = tr.DialContext
+		awsTransport.TLSHandshakeTimeout = tr.TLSHandshakeTimeout
+	}), nil
+}
+
+func (c *SigV4AuthClient) Do(req *http.Request) (*http.Response, error) {
+	creds, err := c.credentials.Retrieve(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("retrieving aws credentials: %s", err)
+	}
+	err = signV4(req.Context(), c.signer, req, creds, c.region, c.service, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+// signV4 adds the X-Amz-Date and Authorization headers described in
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func signV4(ctx context.Context, signer *v4.Signer, req *http.Request, creds aws.Credentials, region, service string, now time.Time) error {
+	payload, err := requestPayload(req)
+	if err != nil {
+		return err
+	}
+	payloadHash := sha256.Sum256(payload)
+	return signer.SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), service, region, now)
+}
+
+// requestPayload reads the request body without consuming it
+func requestPayload(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return []byte{}, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return ioutil.ReadAll(body)
+	}
+	payload, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(payload))
+	return payload, nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package spinnaker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+const defaultVaultAuthMount = "approle"
+
+// resolveVaultSecrets fills in any credential fields left empty in the source
+// from the configured Vault secret, using a token that is revoked afterwards.
+// Vault is reached like Gate, through the proxy and with the CA of the source.
+func resolveVaultSecrets(ctx context.Context, source concourse.Source) (concourse.Source, error) {
+	vault := source.Vault
+	if vault.Address == "" {
+		return source, nil
+	}
+	if vault.SecretPath == "" || vault.RoleID == "" || vault.SecretID == "" {
+		return source, fmt.Errorf("vault.role_id, vault.secret_id and vault.secret_path must be set when vault.address is configured")
+	}
+
+	address := strings.TrimSuffix(vault.Address, "/")
+	client, err := newHTTPClient(source)
+	if err != nil {
+		return source, err
+	}
+
+	authMount := vault.AuthMount
+	if authMount == "" {
+		authMount = defaultVaultAuthMount
+	}
+
+	var login struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	loginBody, err := json.Marshal(map[string]string{"role_id": vault.RoleID, "secret_id": vault.SecretID})
+	if err != nil {
+		return source, err
+	}
+	err = vaultRequest(ctx, client, "POST", fmt.Sprintf("%s/v1/auth/%s/login", address, authMount), "", loginBody, &login)
+	if err != nil {
+		return source, err
+	}
+	token := login.Auth.ClientToken
+	defer vaultRequest(ctx, client, "POST", address+"/v1/auth/token/revoke-self", token, nil, nil)
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = vaultRequest(ctx, client, "GET", fmt.Sprintf("%s/v1/%s", address, strings.TrimPrefix(vault.SecretPath, "/")), token, nil, &secret)
+	if err != nil {
+		return source, err
+	}
+
+	values := secret.Data
+	//KV version 2 nests the secret under data.data
+	if nested, ok := values["data"].(map[string]interface{}); ok {
+		if _, ok := values["metadata"]; ok {
+			values = nested
+		}
+	}
+
+	fields := reflect.ValueOf(&source).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Type().Field(i)
+		if field.Tag.Get("vault") != "true" || fields.Field(i).String() != "" {
+			continue
+		}
+		key := strings.Split(field.Tag.Get("json"), ",")[0]
+		if value, ok := values[key].(string); ok {
+			fields.Field(i).SetString(value)
+		}
+	}
+	return source, nil
+}
+
+func vaultRequest(ctx context.Context, client *http.Client, method, url, token string, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("vault responded with status code: %d, body: %s", res.StatusCode, string(resBody))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resBody, result)
+}
@@ -0,0 +1,261 @@
+/*
+Copyright (C) 2018-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under the terms of the under the Apache License, Version 2.0 (the "License”); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+*/
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/colorstring"
+	"github.com/pivotal-cf/spinnaker-resource/concourse"
+)
+
+const serviceName = "spinnaker-resource"
+
+// span kinds and status codes from the OTLP protocol
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+	statusCodeOK     = 1
+	statusCodeError  = 2
+)
+
+// Span is a timed operation, exported over OTLP when the resource exits. All
+// methods are safe to call on a nil Span, which is what StartSpan returns
+// when tracing isn't configured.
+type Span struct {
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	failed     bool
+}
+
+var (
+	mu       sync.Mutex
+	enabled  bool
+	root     *Span
+	finished []*Span
+)
+
+// Setup starts the span covering the whole step and exports it, with the spans
+// of every Gate call, to the configured OTLP endpoint with the transport when
+// the resource exits
+func Setup(source concourse.Source, step string, transport http.RoundTripper) {
+	if source.OTLPEndpoint == "" {
+		return
+	}
+
+	mu.Lock()
+	enabled = true
+	root = &Span{
+		traceID:    randomHex(16),
+		spanID:     randomHex(8),
+		name:       serviceName + " " + step,
+		kind:       spanKindInternal,
+		start:      time.Now(),
+		attributes: map[string]string{},
+	}
+	mu.Unlock()
+
+	SetAttribute("spinnaker.application", strings.Join(source.Applications(), ","))
+	SetAttribute("spinnaker.pipeline", strings.Join(source.Pipelines(), ","))
+	for _, env := range []string{"BUILD_ID", "BUILD_NAME", "BUILD_JOB_NAME", "BUILD_PIPELINE_NAME", "BUILD_TEAM_NAME"} {
+		SetAttribute("concourse."+strings.ToLower(env), os.Getenv(env))
+	}
+
+	concourse.OnExit(func(failed bool) {
+		mu.Lock()
+		root.failed = failed
+		mu.Unlock()
+		root.End()
+		if err := export(source, transport); err != nil {
+			concourse.Sayf(colorstring.Color("[yellow]WARNING: %s\n"), "exporting traces failed: "+err.Error())
+		}
+	})
+}
+
+// SetAttribute adds an attribute to the span of the step, such as the
+// Spinnaker execution ID once it is known
+func SetAttribute(key, value string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if root != nil && value != "" {
+		root.attributes[key] = value
+	}
+}
+
+// StartSpan starts a span for a call to Spinnaker as a child of the step
+func StartSpan(name string) *Span {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return nil
+	}
+	return &Span{
+		traceID:    root.traceID,
+		spanID:     randomHex(8),
+		parentID:   root.spanID,
+		name:       name,
+		kind:       spanKindClient,
+		start:      time.Now(),
+		attributes: map[string]string{},
+	}
+}
+
+// TraceParent is the W3C trace context header value of the span, so Gate can
+// join the trace
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", s.traceID, s.spanID)
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	s.attributes[key] = value
+}
+
+func (s *Span) SetFailed() {
+	if s == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	s.failed = true
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	s.end = time.Now()
+	finished = append(finished, s)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// the OTLP/HTTP JSON encoding of an ExportTraceServiceRequest
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Status            struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+func keyValues(attributes map[string]string) []otlpKeyValue {
+	kvs := []otlpKeyValue{}
+	for key, value := range attributes {
+		kv := otlpKeyValue{Key: key}
+		kv.Value.StringValue = value
+		kvs = append(kvs, kv)
+	}
+	return kvs
+}
+
+func export(source concourse.Source, transport http.RoundTripper) error {
+	mu.Lock()
+	spans := []otlpSpan{}
+	for _, s := range finished {
+		span := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        keyValues(s.attributes),
+		}
+		span.Status.Code = statusCodeOK
+		if s.failed {
+			span.Status.Code = statusCodeError
+		}
+		spans = append(spans, span)
+	}
+	mu.Unlock()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": keyValues(map[string]string{"service.name": serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": serviceName},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(source.OTLPEndpoint, "/")+"/v1/traces", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range source.OTLPHeaders {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("otlp endpoint responded with status code: %d", res.StatusCode)
+	}
+	return nil
+}